@@ -0,0 +1,85 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+)
+
+// ContractQuery is a query message of the Merkle tree contract. It is sent as
+// {"<QueryName>": <message>}, the externally tagged form CosmWasm contracts
+// expect, and answered with a Response value. Sending a query with the wrong
+// response type, as in QueryContract[[]string](ctx, cqc, GetMerkleTreeQuery{}),
+// does not compile.
+type ContractQuery[Response any] interface {
+	QueryName() string
+	response() Response // Binds the response type, never called
+}
+
+// GetMerkleTreeQuery returns a tree with its leaves and metadata
+type GetMerkleTreeQuery struct {
+	ID string `json:"id"`
+}
+
+func (GetMerkleTreeQuery) QueryName() string        { return "get_merkle_tree" }
+func (GetMerkleTreeQuery) response() (r MerkleTree) { return }
+
+// ListMerkleTreeIdsQuery returns the tree ids after StartAfter, at most Limit
+// of them. Both are omitted when zero, listing every id, as contracts without
+// pagination reject unknown fields.
+type ListMerkleTreeIdsQuery struct {
+	StartAfter string `json:"start_after,omitempty"`
+	Limit      uint32 `json:"limit,omitempty"`
+}
+
+func (ListMerkleTreeIdsQuery) QueryName() string      { return "list_merkle_tree_ids" }
+func (ListMerkleTreeIdsQuery) response() (r []string) { return }
+
+var (
+	_ ContractQuery[MerkleTree] = GetMerkleTreeQuery{}
+	_ ContractQuery[[]string]   = ListMerkleTreeIdsQuery{}
+)
+
+// MarshalQuery encodes a query message as sent to the contract
+func MarshalQuery(query interface{ QueryName() string }) ([]byte, error) {
+	data, err := json.Marshal(map[string]interface{}{query.QueryName(): query})
+	if err != nil {
+		return nil, fmt.Errorf("failed to marshal %s query: %v", query.QueryName(), err)
+	}
+	return data, nil
+}
+
+// contractRequest builds the smart query request of a query message
+func contractRequest[Response any](contractAddr string, query ContractQuery[Response]) (*wasmtypes.QuerySmartContractStateRequest, error) {
+	data, err := MarshalQuery(query)
+	if err != nil {
+		return nil, err
+	}
+	return &wasmtypes.QuerySmartContractStateRequest{
+		Address:   contractAddr,
+		QueryData: data,
+	}, nil
+}
+
+// QueryContract sends query to the Merkle tree contract and decodes its
+// response. It also returns the block height the query was answered at, 0
+// when the node did not report it.
+func QueryContract[Response any](ctx context.Context, cqc *CosmosQueryClient, query ContractQuery[Response]) (*Response, int64, error) {
+	request, err := contractRequest(cqc.config.ContractAddr, query)
+	if err != nil {
+		return nil, 0, err
+	}
+
+	res, height, err := cqc.smartContractState(ctx, request)
+	if err != nil {
+		return nil, 0, fmt.Errorf("failed to query contract: %v", err)
+	}
+
+	var response Response
+	if err := json.Unmarshal(res.Data, &response); err != nil {
+		return nil, 0, fmt.Errorf("failed to unmarshal %s response: %v", query.QueryName(), err)
+	}
+	return &response, height, nil
+}
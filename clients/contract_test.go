@@ -0,0 +1,102 @@
+package clients
+
+import (
+	"bytes"
+	"encoding/json"
+	"reflect"
+	"testing"
+)
+
+func TestMarshalQuery(t *testing.T) {
+	tests := []struct {
+		query interface{ QueryName() string }
+		want  string
+	}{
+		{GetMerkleTreeQuery{ID: "tree-1"}, `{"get_merkle_tree":{"id":"tree-1"}}`},
+		{ListMerkleTreeIdsQuery{}, `{"list_merkle_tree_ids":{}}`},
+		{ListMerkleTreeIdsQuery{StartAfter: "tree-1", Limit: 30}, `{"list_merkle_tree_ids":{"start_after":"tree-1","limit":30}}`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.query.QueryName(), func(t *testing.T) {
+			data, err := MarshalQuery(tt.query)
+			if err != nil {
+				t.Fatalf("MarshalQuery: %v", err)
+			}
+			if string(data) != tt.want {
+				t.Errorf("MarshalQuery = %s, want %s", data, tt.want)
+			}
+
+			// Decode the message the way the contract does and encode it again
+			var decoded map[string]json.RawMessage
+			if err := json.Unmarshal(data, &decoded); err != nil {
+				t.Fatalf("query is not a JSON object: %v", err)
+			}
+			message := reflect.New(reflect.TypeOf(tt.query))
+			if err := json.Unmarshal(decoded[tt.query.QueryName()], message.Interface()); err != nil {
+				t.Fatalf("failed to unmarshal message: %v", err)
+			}
+			if !reflect.DeepEqual(message.Elem().Interface(), tt.query) {
+				t.Errorf("round trip = %+v, want %+v", message.Elem().Interface(), tt.query)
+			}
+		})
+	}
+}
+
+func TestContractRequest(t *testing.T) {
+	request, err := contractRequest("wasm1contract", GetMerkleTreeQuery{ID: "tree-1"})
+	if err != nil {
+		t.Fatalf("contractRequest: %v", err)
+	}
+	if request.Address != "wasm1contract" || string(request.QueryData) != `{"get_merkle_tree":{"id":"tree-1"}}` {
+		t.Errorf("request = %s %s", request.Address, request.QueryData)
+	}
+}
+
+// Responses as returned by the contract
+func TestContractResponses(t *testing.T) {
+	tests := []struct {
+		name string
+		data string
+		into interface{}
+		want interface{}
+	}{
+		{
+			name: "get_merkle_tree",
+			data: `{"root":"d71dc32fa2cd95be60b32dbb3e63009fa8064407ee19f457c92a09a5ff841a8a","leaves":["a","b","c"],"metadata":"{\"owner\":\"wasm1owner\",\"tags\":[\"daily\"]}"}`,
+			into: &MerkleTree{},
+			want: &MerkleTree{
+				Root:     "d71dc32fa2cd95be60b32dbb3e63009fa8064407ee19f457c92a09a5ff841a8a",
+				Leaves:   []string{"a", "b", "c"},
+				Metadata: `{"owner":"wasm1owner","tags":["daily"]}`,
+			},
+		},
+		{
+			name: "list_merkle_tree_ids",
+			data: `["tree-1","tree-2"]`,
+			into: &[]string{},
+			want: &[]string{"tree-1", "tree-2"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if err := json.Unmarshal([]byte(tt.data), tt.into); err != nil {
+				t.Fatalf("failed to unmarshal response: %v", err)
+			}
+			if !reflect.DeepEqual(tt.into, tt.want) {
+				t.Errorf("response = %+v, want %+v", tt.into, tt.want)
+			}
+
+			data, err := json.Marshal(tt.into)
+			if err != nil {
+				t.Fatalf("failed to marshal response: %v", err)
+			}
+			var compacted bytes.Buffer
+			if err := json.Compact(&compacted, []byte(tt.data)); err != nil {
+				t.Fatalf("invalid fixture: %v", err)
+			}
+			if string(data) != compacted.String() {
+				t.Errorf("round trip = %s, want %s", data, compacted.String())
+			}
+		})
+	}
+}
@@ -2,187 +2,247 @@ package clients
 
 import (
 	"context"
-	"encoding/json"
+	"crypto/tls"
+	"crypto/x509"
 	"fmt"
-	"log"
+	"os"
+	"time"
 
-	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
-	"github.com/Layer-Edge/light-node/utils"
 	"google.golang.org/grpc"
+	"google.golang.org/grpc/credentials"
 	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/keepalive"
 )
 
 // ClientConfig holds all configurable parameters for the clients package
 type ClientConfig struct {
-	GrpcURL      string
-	ContractAddr string
+	GrpcURLs            []string // Endpoints queried in order of health and latency
+	ContractAddr        string
+	HealthCheckInterval time.Duration     // Probe every endpoint this often, 0 disables the probes
+	KeepaliveTime       time.Duration     // Ping an idle connection this often, 0 disables keepalive
+	KeepaliveTimeout    time.Duration     // Close the connection when a ping is not answered in time
+	TLS                 TLSConfig         // Transport security, plaintext when disabled
+	Metadata            map[string]string // Sent with every RPC, e.g. an API key header
+	TreePageSize        uint32            // Tree ids fetched per query, 0 fetches them all at once
+	TreeCacheTTL        time.Duration     // Share fetched trees between workers this long, 0 disables the cache
+	TreeCacheSize       int               // Maximum number of cached trees
+	TreeCacheMaxLeaves  int               // Maximum number of leaves of all cached trees
+	Proof               ProofConfig       // Verify the trees against light client headers
 }
 
-// Global configuration with default values
-var globalClientConfig = ClientConfig{
-	GrpcURL:      "grpc.testnet.layeredge.io:9090",                                    // Default gRPC endpoint
-	ContractAddr: "cosmos1ufs3tlq4umljk0qfe8k5ya0x6hpavn897u2cnf9k0en9jr7qarqqt56709", // Default contract address
+// TLSConfig selects the transport security of the gRPC connection
+type TLSConfig struct {
+	Enabled    bool   // Use TLS, verified against the system roots unless CAFile is set
+	CAFile     string // PEM bundle of the CAs trusted to sign the server certificate
+	CertFile   string // Client certificate for mutual TLS
+	KeyFile    string // Key of the client certificate
+	ServerName string // Overrides the name checked against the server certificate
 }
 
-// InitClientConfig initializes the client configuration with environment variables or defaults
-func InitClientConfig() {
-	globalClientConfig.GrpcURL = utils.GetEnv("GRPC_URL", "grpc.testnet.layeredge.io:9090")
-	globalClientConfig.ContractAddr = utils.GetEnv("CONTRACT_ADDR", "cosmos1ufs3tlq4umljk0qfe8k5ya0x6hpavn897u2cnf9k0en9jr7qarqqt56709")
+// transportCredentials builds the credentials selected by config
+func (config TLSConfig) transportCredentials() (credentials.TransportCredentials, error) {
+	if !config.Enabled {
+		return insecure.NewCredentials(), nil
+	}
 
-	log.Printf("Initialized client configuration: GRPC_URL=%s, CONTRACT_ADDR=%s",
-		globalClientConfig.GrpcURL, globalClientConfig.ContractAddr)
-}
+	tlsConfig := &tls.Config{
+		MinVersion: tls.VersionTLS12,
+		ServerName: config.ServerName,
+	}
+
+	// Without a CA bundle the system roots are used
+	if config.CAFile != "" {
+		pem, err := os.ReadFile(config.CAFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to read CA bundle %s: %v", config.CAFile, err)
+		}
+		pool := x509.NewCertPool()
+		if !pool.AppendCertsFromPEM(pem) {
+			return nil, fmt.Errorf("no certificate found in CA bundle %s", config.CAFile)
+		}
+		tlsConfig.RootCAs = pool
+	}
+
+	if config.CertFile != "" || config.KeyFile != "" {
+		certificate, err := tls.LoadX509KeyPair(config.CertFile, config.KeyFile)
+		if err != nil {
+			return nil, fmt.Errorf("failed to load client certificate %s: %v", config.CertFile, err)
+		}
+		tlsConfig.Certificates = []tls.Certificate{certificate}
+	}
 
-// SetClientConfig allows overriding the configuration programmatically
-func SetClientConfig(config ClientConfig) {
-	globalClientConfig = config
-	log.Printf("Updated client configuration: GRPC_URL=%s, CONTRACT_ADDR=%s",
-		globalClientConfig.GrpcURL, globalClientConfig.ContractAddr)
+	return credentials.NewTLS(tlsConfig), nil
 }
 
-// GetClientConfig returns a copy of the current configuration
-func GetClientConfig() ClientConfig {
-	return globalClientConfig
+// metadataCredentials attaches fixed metadata, such as an API key, to every
+// RPC
+type metadataCredentials struct {
+	metadata map[string]string
+	secure   bool
 }
 
-type MerkleTree struct {
-	Root     string   `json:"root"`
-	Leaves   []string `json:"leaves"`
-	Metadata string   `json:"metadata"`
+func (c metadataCredentials) GetRequestMetadata(ctx context.Context, uri ...string) (map[string]string, error) {
+	return c.metadata, nil
 }
 
-type QueryGetTree struct {
-	GetMerkleTree struct {
-		ID string `json:"id"`
-	} `json:"get_merkle_tree"`
+// RequireTransportSecurity only requires TLS when the connection uses it, so
+// metadata can still reach plaintext endpoints such as a local gateway
+func (c metadataCredentials) RequireTransportSecurity() bool {
+	return c.secure
 }
 
-type QueryListTreeIDs struct {
-	ListMerkleTreeIds struct {
-	} `json:"list_merkle_tree_ids"`
+type MerkleTree struct {
+	ID       string        `json:"-"` // Tree id the tree was queried with
+	Root     string        `json:"root"`
+	Leaves   []string      `json:"leaves"`
+	Metadata string        `json:"metadata"`
+	Info     *TreeMetadata `json:"-"` // Parsed Metadata, nil when it is not a JSON object
+	Height   int64         `json:"-"` // Block height the tree was read at, 0 when unknown
 }
 
 type CosmosQueryClient struct {
-	conn        *grpc.ClientConn
-	queryClient wasmtypes.QueryClient
-	config      ClientConfig
-	proxy       string // Proxy URL để sử dụng cho các yêu cầu HTTP
+	endpoints []*endpoint
+	config    ClientConfig
+	cache     *treeCache     // nil when disabled
+	verifier  *stateVerifier // nil when proofs are disabled
+	proxy     string         // Proxy URL để sử dụng cho các yêu cầu HTTP
 }
 
-func (cqc *CosmosQueryClient) Init() error {
-	globalClientConfig.GrpcURL = utils.GetEnv("GRPC_URL", "grpc.testnet.layeredge.io:9090")
-	globalClientConfig.ContractAddr = utils.GetEnv("CONTRACT_ADDR", "cosmos1ufs3tlq4umljk0qfe8k5ya0x6hpavn897u2cnf9k0en9jr7qarqqt56709")
-	// Use the global configuration
-	cqc.config = globalClientConfig
+// NewCosmosQueryClient creates a client meant to be shared for the lifetime
+// of the process. gRPC multiplexes concurrent queries over its connection,
+// keeps it alive with pings and re-establishes it when it drops.
+func NewCosmosQueryClient(config ClientConfig) (*CosmosQueryClient, error) {
+	cqc := &CosmosQueryClient{}
+	if err := cqc.InitWithConfig(config); err != nil {
+		return nil, err
+	}
+	return cqc, nil
+}
 
-	// Connect to gRPC client
-	conn, err := grpc.Dial(cqc.config.GrpcURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+func dialOptions(config ClientConfig) ([]grpc.DialOption, error) {
+	transportCredentials, err := config.TLS.transportCredentials()
 	if err != nil {
-		return fmt.Errorf("failed to connect to gRPC at %s: %v", cqc.config.GrpcURL, err)
+		return nil, err
 	}
 
-	cqc.conn = conn
-	cqc.queryClient = wasmtypes.NewQueryClient(conn)
-	return nil
+	options := []grpc.DialOption{grpc.WithTransportCredentials(transportCredentials)}
+	if len(config.Metadata) > 0 {
+		options = append(options, grpc.WithPerRPCCredentials(metadataCredentials{
+			metadata: config.Metadata,
+			secure:   config.TLS.Enabled,
+		}))
+	}
+	if config.KeepaliveTime > 0 {
+		options = append(options, grpc.WithKeepaliveParams(keepalive.ClientParameters{
+			Time:                config.KeepaliveTime,
+			Timeout:             config.KeepaliveTimeout,
+			PermitWithoutStream: true,
+		}))
+	}
+	return options, nil
 }
 
-// InitWithConfig initializes the client with a specific configuration
+// InitWithConfig initializes the client with a specific configuration,
+// creating a connection to every endpoint
 func (cqc *CosmosQueryClient) InitWithConfig(config ClientConfig) error {
+	if len(config.GrpcURLs) == 0 {
+		return fmt.Errorf("no gRPC endpoint configured")
+	}
 	cqc.config = config
 
-	// Connect to gRPC client
-	conn, err := grpc.Dial(cqc.config.GrpcURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
+	options, err := dialOptions(cqc.config)
 	if err != nil {
-		return fmt.Errorf("failed to connect to gRPC at %s: %v", cqc.config.GrpcURL, err)
+		return err
 	}
 
-	cqc.conn = conn
-	cqc.queryClient = wasmtypes.NewQueryClient(conn)
+	// Connect to gRPC client
+	var endpoints []*endpoint
+	for _, grpcURL := range cqc.config.GrpcURLs {
+		conn, err := grpc.Dial(grpcURL, options...)
+		if err != nil {
+			for _, e := range endpoints {
+				e.conn.Close()
+			}
+			return fmt.Errorf("failed to connect to gRPC at %s: %v", grpcURL, err)
+		}
+		endpoints = append(endpoints, newEndpoint(grpcURL, conn))
+	}
+
+	cqc.endpoints = endpoints
+	if config.Proof.Enabled {
+		ctx, cancel := context.WithTimeout(context.Background(), lightClientInitTimeout)
+		defer cancel()
+		cqc.verifier, err = newStateVerifier(ctx, config.Proof, config.ContractAddr)
+		if err != nil {
+			cqc.Close()
+			return err
+		}
+	}
+	if config.TreeCacheTTL > 0 {
+		cqc.cache = newTreeCache(config.TreeCacheTTL, config.TreeCacheSize, config.TreeCacheMaxLeaves)
+	}
 	return nil
 }
 
-// InitWithProxy initializes the client with a specific proxy
-func (cqc *CosmosQueryClient) InitWithProxy(proxy string) error {
-	// Sử dụng cấu hình mặc định nhưng với proxy
-	globalClientConfig.GrpcURL = utils.GetEnv("GRPC_URL", "grpc.testnet.layeredge.io:9090")
-	globalClientConfig.ContractAddr = utils.GetEnv("CONTRACT_ADDR", "cosmos1ufs3tlq4umljk0qfe8k5ya0x6hpavn897u2cnf9k0en9jr7qarqqt56709")
-	cqc.config = globalClientConfig
-
+// InitWithProxy initializes the client with a specific configuration and proxy
+func (cqc *CosmosQueryClient) InitWithProxy(config ClientConfig, proxy string) error {
 	// Lưu proxy để sử dụng trong các yêu cầu HTTP
-	cqc.proxy = proxy
-
-	// Connect to gRPC client
 	// Lưu ý: gRPC không hỗ trợ trực tiếp proxy, chúng ta sẽ sử dụng proxy trong các yêu cầu HTTP
-	conn, err := grpc.Dial(cqc.config.GrpcURL, grpc.WithTransportCredentials(insecure.NewCredentials()))
-	if err != nil {
-		return fmt.Errorf("failed to connect to gRPC at %s: %v", cqc.config.GrpcURL, err)
-	}
-
-	cqc.conn = conn
-	cqc.queryClient = wasmtypes.NewQueryClient(conn)
-	return nil
+	cqc.proxy = proxy
+	return cqc.InitWithConfig(config)
 }
 
 func (cqc *CosmosQueryClient) Close() {
-	if cqc.conn != nil {
-		cqc.conn.Close()
+	for _, e := range cqc.endpoints {
+		e.conn.Close()
 	}
 }
 
-func (cqc *CosmosQueryClient) GetMerkleTreeData(id string) (*MerkleTree, error) {
-	query := QueryGetTree{}
-	query.GetMerkleTree.ID = id
-
-	queryBytes, err := json.Marshal(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal query: %v", err)
+// GetMerkleTreeData returns the tree with the given id, from the tree cache
+// when it is enabled
+func (cqc *CosmosQueryClient) GetMerkleTreeData(ctx context.Context, id string) (*MerkleTree, error) {
+	if cqc.cache == nil {
+		return cqc.fetchMerkleTree(ctx, id)
 	}
+	return cqc.cache.get(ctx, id, func(ctx context.Context) (*MerkleTree, error) {
+		return cqc.fetchMerkleTree(ctx, id)
+	})
+}
 
-	res, err := cqc.queryClient.SmartContractState(
-		context.Background(),
-		&wasmtypes.QuerySmartContractStateRequest{
-			Address:   cqc.config.ContractAddr,
-			QueryData: queryBytes,
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query contract: %v", err)
+func (cqc *CosmosQueryClient) fetchMerkleTree(ctx context.Context, id string) (*MerkleTree, error) {
+	if cqc.verifier != nil {
+		return cqc.fetchProvenMerkleTree(ctx, id)
 	}
 
-	// Parse response JSON into struct
-	var tree MerkleTree
-	err = json.Unmarshal(res.Data, &tree)
+	tree, height, err := QueryContract[MerkleTree](ctx, cqc, GetMerkleTreeQuery{ID: id})
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal tree data: %v", err)
+		return nil, err
 	}
-
-	return &tree, nil
+	tree.ID = id
+	tree.Info = ParseTreeMetadata(tree.Metadata)
+	tree.Height = height
+	return tree, nil
 }
 
-func (cqc *CosmosQueryClient) ListMerkleTreeIds() ([]string, error) {
-	query := QueryListTreeIDs{}
-
-	queryBytes, err := json.Marshal(query)
-	if err != nil {
-		return nil, fmt.Errorf("failed to marshal query: %v", err)
-	}
-
-	res, err := cqc.queryClient.SmartContractState(
-		context.Background(),
-		&wasmtypes.QuerySmartContractStateRequest{
-			Address:   cqc.config.ContractAddr,
-			QueryData: queryBytes,
-		},
-	)
-	if err != nil {
-		return nil, fmt.Errorf("failed to query contract: %v", err)
+// ListMerkleTreeIds returns every tree id, fetching them TreePageSize at a
+// time when pagination is enabled
+func (cqc *CosmosQueryClient) ListMerkleTreeIds(ctx context.Context) ([]string, error) {
+	var treeIds []string
+	for treeId, err := range cqc.MerkleTreeIds(ctx) {
+		if err != nil {
+			return nil, err
+		}
+		treeIds = append(treeIds, treeId)
 	}
+	return treeIds, nil
+}
 
-	// Parse response JSON into struct
-	var treeIds []string
-	err = json.Unmarshal(res.Data, &treeIds)
+// ListMerkleTreeIdsPage returns at most limit tree ids following startAfter,
+// or every id when limit is 0
+func (cqc *CosmosQueryClient) ListMerkleTreeIdsPage(ctx context.Context, startAfter string, limit uint32) ([]string, error) {
+	treeIds, _, err := QueryContract[[]string](ctx, cqc, ListMerkleTreeIdsQuery{StartAfter: startAfter, Limit: limit})
 	if err != nil {
-		return nil, fmt.Errorf("failed to unmarshal tree data: %v", err)
+		return nil, err
 	}
-	return treeIds, nil
+	return *treeIds, nil
 }
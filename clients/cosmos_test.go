@@ -0,0 +1,67 @@
+package clients
+
+import (
+	"context"
+	"testing"
+)
+
+var benchmarkTrees = map[string]MerkleTree{
+	"tree-1": {Root: "root", Leaves: []string{"a", "b", "c"}, Metadata: "daily batch"},
+}
+
+// BenchmarkQueryDialPerQuery connects to the node for every query, as the
+// client did before it was shared
+func BenchmarkQueryDialPerQuery(b *testing.B) {
+	listener := listenFakeNode(b, &fakeNode{height: 100, trees: benchmarkTrees})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		conn, err := dialFakeNode(listener)
+		if err != nil {
+			b.Fatalf("dial: %v", err)
+		}
+		cqc := &CosmosQueryClient{
+			config:    ClientConfig{ContractAddr: "wasm1contract"},
+			endpoints: []*endpoint{newEndpoint("bufnet", conn)},
+		}
+		if _, err := cqc.GetMerkleTreeData(ctx, "tree-1"); err != nil {
+			b.Fatalf("GetMerkleTreeData: %v", err)
+		}
+		cqc.Close()
+	}
+}
+
+// BenchmarkQuerySharedClient runs every query over one shared client, as
+// the workers do
+func BenchmarkQuerySharedClient(b *testing.B) {
+	cqc := newFakeClient(b, &fakeNode{height: 100, trees: benchmarkTrees})
+	ctx := context.Background()
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	for i := 0; i < b.N; i++ {
+		if _, err := cqc.GetMerkleTreeData(ctx, "tree-1"); err != nil {
+			b.Fatalf("GetMerkleTreeData: %v", err)
+		}
+	}
+}
+
+// BenchmarkQuerySharedClientParallel runs concurrent queries over one shared
+// client, which gRPC multiplexes over a single connection
+func BenchmarkQuerySharedClientParallel(b *testing.B) {
+	cqc := newFakeClient(b, &fakeNode{height: 100, trees: benchmarkTrees})
+
+	b.ReportAllocs()
+	b.ResetTimer()
+	b.RunParallel(func(pb *testing.PB) {
+		ctx := context.Background()
+		for pb.Next() {
+			if _, err := cqc.GetMerkleTreeData(ctx, "tree-1"); err != nil {
+				b.Errorf("GetMerkleTreeData: %v", err)
+				return
+			}
+		}
+	})
+}
@@ -0,0 +1,339 @@
+package clients
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/connectivity"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Weight of the newest sample in the latency moving average
+	latencyWeight = 0.3
+	// Timeout of a single health probe
+	healthCheckTimeout = 10 * time.Second
+)
+
+// endpoint is one gRPC node with its health and latency
+type endpoint struct {
+	url           string
+	conn          *grpc.ClientConn
+	queryClient   wasmtypes.QueryClient
+	serviceClient cmtservice.ServiceClient
+
+	mu        sync.Mutex
+	healthy   bool
+	latency   time.Duration // Moving average of successful calls
+	height    int64         // Latest block height the endpoint is known to have
+	lastError string
+	lastCheck time.Time
+}
+
+func newEndpoint(url string, conn *grpc.ClientConn) *endpoint {
+	return &endpoint{
+		url:           url,
+		conn:          conn,
+		queryClient:   wasmtypes.NewQueryClient(conn),
+		serviceClient: cmtservice.NewServiceClient(conn),
+		healthy:       true,
+	}
+}
+
+// EndpointStatus is a snapshot of the health of a gRPC endpoint
+type EndpointStatus struct {
+	URL       string        `json:"url"`
+	State     string        `json:"state"`
+	Healthy   bool          `json:"healthy"`
+	Latency   time.Duration `json:"latency_ns"`
+	Height    int64         `json:"height"`
+	LastError string        `json:"last_error,omitempty"`
+	LastCheck time.Time     `json:"last_check"`
+}
+
+func (e *endpoint) recordSuccess(latency time.Duration) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if !e.healthy {
+		logger.Info("gRPC endpoint is healthy again", "endpoint", e.url)
+	}
+	e.healthy = true
+	e.lastError = ""
+	e.lastCheck = time.Now()
+	if e.latency == 0 {
+		e.latency = latency
+	} else {
+		e.latency = time.Duration(latencyWeight*float64(latency) + (1-latencyWeight)*float64(e.latency))
+	}
+}
+
+func (e *endpoint) recordFailure(err error) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	if e.healthy {
+		logger.Warn("gRPC endpoint is unhealthy", "endpoint", e.url, "error", err)
+	}
+	e.healthy = false
+	e.lastError = err.Error()
+	e.lastCheck = time.Now()
+}
+
+// observeHeight records that the endpoint has reached height
+func (e *endpoint) observeHeight(height int64) {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	e.height = max(e.height, height)
+}
+
+// hasHeight reports whether the endpoint is known to have reached height
+func (e *endpoint) hasHeight(height int64) bool {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return e.height >= height
+}
+
+// probeHeight asks the endpoint for its latest block height, outside of the
+// height pinned in ctx
+func (e *endpoint) probeHeight(ctx context.Context) (int64, error) {
+	probeCtx, cancel := context.WithTimeout(unpinned(ctx), healthCheckTimeout)
+	defer cancel()
+	return e.latestHeight(probeCtx)
+}
+
+func (e *endpoint) status() EndpointStatus {
+	e.mu.Lock()
+	defer e.mu.Unlock()
+
+	return EndpointStatus{
+		URL:       e.url,
+		State:     e.conn.GetState().String(),
+		Healthy:   e.healthy,
+		Latency:   e.latency,
+		Height:    e.height,
+		LastError: e.lastError,
+		LastCheck: e.lastCheck,
+	}
+}
+
+// isEndpointFailure reports whether err means the endpoint itself failed, or
+// returned data failing verification, as opposed to the contract rejecting
+// the query, which every endpoint would do
+func isEndpointFailure(err error) bool {
+	switch status.Code(err) {
+	case codes.Unavailable, codes.DeadlineExceeded, codes.ResourceExhausted, codes.Aborted, codes.Internal, codes.DataLoss:
+		return true
+	default:
+		return false
+	}
+}
+
+// orderedEndpoints returns the healthy endpoints, fastest first, followed by
+// the unhealthy ones in configuration order as a last resort
+func (cqc *CosmosQueryClient) orderedEndpoints() []*endpoint {
+	type candidate struct {
+		endpoint *endpoint
+		healthy  bool
+		latency  time.Duration
+	}
+	candidates := make([]candidate, len(cqc.endpoints))
+	for i, e := range cqc.endpoints {
+		e.mu.Lock()
+		candidates[i] = candidate{e, e.healthy, e.latency}
+		e.mu.Unlock()
+	}
+
+	sort.SliceStable(candidates, func(i, j int) bool {
+		if candidates[i].healthy != candidates[j].healthy {
+			return candidates[i].healthy
+		}
+		return candidates[i].healthy && candidates[i].latency < candidates[j].latency
+	})
+
+	ordered := make([]*endpoint, len(candidates))
+	for i, c := range candidates {
+		ordered[i] = c.endpoint
+	}
+	return ordered
+}
+
+// call runs fn on the best endpoint, failing over to the next one when an
+// endpoint is unavailable. When ctx pins a block height, only the endpoints
+// that have reached it are used, so a lagging endpoint cannot answer for a
+// block it does not have yet.
+func (cqc *CosmosQueryClient) call(ctx context.Context, fn func(e *endpoint) error) error {
+	height := pinnedHeight(ctx)
+	var errs []error
+	for _, e := range cqc.orderedEndpoints() {
+		if height > 0 && !e.hasHeight(height) {
+			// The height last seen may be stale, as it is only refreshed by
+			// health probes and queries, so ask the endpoint
+			latest, err := e.probeHeight(ctx)
+			if ctx.Err() != nil {
+				return ctx.Err()
+			}
+			if err != nil {
+				e.recordFailure(err)
+				errs = append(errs, fmt.Errorf("%s: %w", e.url, err))
+				logger.Warn("gRPC endpoint failed", "endpoint", e.url, "error", err)
+				continue
+			}
+			if latest < height {
+				continue
+			}
+		}
+
+		start := time.Now()
+		err := fn(e)
+		if err == nil {
+			e.recordSuccess(time.Since(start))
+			return nil
+		}
+		if ctx.Err() != nil || !isEndpointFailure(err) {
+			return err
+		}
+
+		e.recordFailure(err)
+		errs = append(errs, fmt.Errorf("%s: %w", e.url, err))
+		logger.Warn("gRPC endpoint failed", "endpoint", e.url, "error", err)
+	}
+	if len(errs) == 0 {
+		return status.Errorf(codes.Unavailable, "no gRPC endpoint has reached height %d", height)
+	}
+	return errors.Join(errs...)
+}
+
+// smartContractState runs the query on the best endpoint and returns the
+// block height it was answered at
+func (cqc *CosmosQueryClient) smartContractState(ctx context.Context, request *wasmtypes.QuerySmartContractStateRequest) (*wasmtypes.QuerySmartContractStateResponse, int64, error) {
+	var res *wasmtypes.QuerySmartContractStateResponse
+	var header metadata.MD
+	err := cqc.call(ctx, func(e *endpoint) error {
+		var err error
+		header = nil
+		res, err = e.queryClient.SmartContractState(ctx, request, grpc.Header(&header))
+		if err == nil {
+			e.observeHeight(headerHeight(header))
+		}
+		return err
+	})
+	if err != nil {
+		return nil, 0, err
+	}
+	return res, headerHeight(header), nil
+}
+
+// Endpoints returns the health of every endpoint, in configuration order
+func (cqc *CosmosQueryClient) Endpoints() []EndpointStatus {
+	statuses := make([]EndpointStatus, len(cqc.endpoints))
+	for i, e := range cqc.endpoints {
+		statuses[i] = e.status()
+	}
+	return statuses
+}
+
+// RunHealthChecks probes every endpoint with a contract query every
+// HealthCheckInterval, so failed endpoints are put back in rotation once they
+// recover and latencies stay current, until ctx is cancelled
+func (cqc *CosmosQueryClient) RunHealthChecks(ctx context.Context) {
+	if cqc.config.HealthCheckInterval <= 0 {
+		return
+	}
+
+	ticker := time.NewTicker(cqc.config.HealthCheckInterval)
+	defer ticker.Stop()
+
+	for {
+		cqc.checkEndpoints(ctx)
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+func (cqc *CosmosQueryClient) checkEndpoints(ctx context.Context) {
+	// A single id is enough to know the contract answers
+	var limit uint32
+	if cqc.config.TreePageSize > 0 {
+		limit = 1
+	}
+	request, err := contractRequest(cqc.config.ContractAddr, ListMerkleTreeIdsQuery{Limit: limit})
+	if err != nil {
+		logger.Error("failed to build health check query", "error", err)
+		return
+	}
+
+	var wg sync.WaitGroup
+	for _, e := range cqc.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			probeCtx, cancel := context.WithTimeout(ctx, healthCheckTimeout)
+			defer cancel()
+
+			// The answer also tells how far the endpoint has synced
+			start := time.Now()
+			var header metadata.MD
+			_, err := e.queryClient.SmartContractState(probeCtx, request, grpc.Header(&header))
+			if ctx.Err() != nil {
+				return
+			}
+			if err != nil {
+				e.recordFailure(err)
+			} else {
+				e.recordSuccess(time.Since(start))
+				e.observeHeight(headerHeight(header))
+			}
+		}(e)
+	}
+	wg.Wait()
+}
+
+// MonitorConnection logs every state change of the gRPC connections and
+// makes an idle connection reconnect right away instead of on the next
+// query, until ctx is cancelled
+func (cqc *CosmosQueryClient) MonitorConnection(ctx context.Context) {
+	var wg sync.WaitGroup
+	for _, e := range cqc.endpoints {
+		wg.Add(1)
+		go func(e *endpoint) {
+			defer wg.Done()
+			e.monitorConnection(ctx)
+		}(e)
+	}
+	wg.Wait()
+}
+
+func (e *endpoint) monitorConnection(ctx context.Context) {
+	state := e.conn.GetState()
+	for {
+		if state == connectivity.Idle {
+			e.conn.Connect()
+		}
+		if !e.conn.WaitForStateChange(ctx, state) {
+			return
+		}
+
+		next := e.conn.GetState()
+		if next == connectivity.TransientFailure {
+			logger.Warn("gRPC connection failed, reconnecting", "endpoint", e.url, "from", state.String())
+		} else {
+			logger.Info("gRPC connection state changed", "endpoint", e.url, "from", state.String(), "to", next.String())
+		}
+		state = next
+	}
+}
@@ -0,0 +1,256 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"net"
+	"slices"
+	"strconv"
+	"sync"
+	"testing"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"google.golang.org/grpc"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/credentials/insecure"
+	"google.golang.org/grpc/metadata"
+	"google.golang.org/grpc/status"
+	"google.golang.org/grpc/test/bufconn"
+)
+
+// fakeNode answers the contract and block queries of a node synced up to
+// height, serving the same trees at every height
+type fakeNode struct {
+	wasmtypes.UnimplementedQueryServer
+	cmtservice.UnimplementedServiceServer
+
+	mu      sync.Mutex
+	height  int64
+	down    bool
+	queries int // Contract queries received
+	trees   map[string]MerkleTree
+	idLimit int // Maximum ids listed per query, 0 for no cap
+
+	// Answers the store queries
+	storage func(request *cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse
+}
+
+func (n *fakeNode) SmartContractState(ctx context.Context, request *wasmtypes.QuerySmartContractStateRequest) (*wasmtypes.QuerySmartContractStateResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.queries++
+	if n.down {
+		return nil, status.Error(codes.Unavailable, "node is down")
+	}
+	height := n.height
+	if values := metadata.ValueFromIncomingContext(ctx, grpctypes.GRPCBlockHeightHeader); len(values) > 0 {
+		pinned, err := strconv.ParseInt(values[0], 10, 64)
+		if err != nil {
+			return nil, status.Error(codes.InvalidArgument, err.Error())
+		}
+		// What a node answers for a block it has not reached yet
+		if pinned > n.height {
+			return nil, status.Errorf(codes.InvalidArgument, "cannot query with height in the future; please provide a valid height")
+		}
+		height = pinned
+	}
+
+	var query map[string]json.RawMessage
+	if err := json.Unmarshal(request.QueryData, &query); err != nil {
+		return nil, status.Error(codes.InvalidArgument, err.Error())
+	}
+	var response interface{}
+	switch {
+	case query["get_merkle_tree"] != nil:
+		var message GetMerkleTreeQuery
+		json.Unmarshal(query["get_merkle_tree"], &message)
+		tree, ok := n.trees[message.ID]
+		if !ok {
+			return nil, status.Errorf(codes.Unknown, "tree %s not found", message.ID)
+		}
+		response = tree
+	case query["list_merkle_tree_ids"] != nil:
+		var message ListMerkleTreeIdsQuery
+		json.Unmarshal(query["list_merkle_tree_ids"], &message)
+		treeIds := []string{}
+		for treeId := range n.trees {
+			if treeId > message.StartAfter {
+				treeIds = append(treeIds, treeId)
+			}
+		}
+		slices.Sort(treeIds)
+		// Like cw-storage-plus contracts, cap the limit asked for
+		limit := int(message.Limit)
+		if n.idLimit > 0 && (limit == 0 || limit > n.idLimit) {
+			limit = n.idLimit
+		}
+		if limit > 0 && len(treeIds) > limit {
+			treeIds = treeIds[:limit]
+		}
+		response = treeIds
+	default:
+		return nil, status.Errorf(codes.InvalidArgument, "unknown query %s", request.QueryData)
+	}
+
+	data, err := json.Marshal(response)
+	if err != nil {
+		return nil, status.Error(codes.Internal, err.Error())
+	}
+	grpc.SetHeader(ctx, metadata.Pairs(grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10)))
+	return &wasmtypes.QuerySmartContractStateResponse{Data: data}, nil
+}
+
+func (n *fakeNode) GetLatestBlock(ctx context.Context, request *cmtservice.GetLatestBlockRequest) (*cmtservice.GetLatestBlockResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	if n.down {
+		return nil, status.Error(codes.Unavailable, "node is down")
+	}
+	// Nodes check the pinned height on every query
+	if values := metadata.ValueFromIncomingContext(ctx, grpctypes.GRPCBlockHeightHeader); len(values) > 0 {
+		if pinned, _ := strconv.ParseInt(values[0], 10, 64); pinned > n.height {
+			return nil, status.Errorf(codes.InvalidArgument, "cannot query with height in the future; please provide a valid height")
+		}
+	}
+	return &cmtservice.GetLatestBlockResponse{SdkBlock: &cmtservice.Block{Header: cmtservice.Header{Height: n.height}}}, nil
+}
+
+func (n *fakeNode) set(height int64, down bool) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	n.height, n.down = height, down
+}
+
+func (n *fakeNode) queryCount() int {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+	return n.queries
+}
+
+// listenFakeNode serves node over an in-memory listener
+func listenFakeNode(tb testing.TB, node *fakeNode) *bufconn.Listener {
+	listener := bufconn.Listen(1 << 20)
+	server := grpc.NewServer()
+	wasmtypes.RegisterQueryServer(server, node)
+	cmtservice.RegisterServiceServer(server, node)
+	go server.Serve(listener)
+	tb.Cleanup(server.Stop)
+	return listener
+}
+
+func dialFakeNode(listener *bufconn.Listener) (*grpc.ClientConn, error) {
+	return grpc.NewClient("passthrough:///bufnet",
+		grpc.WithContextDialer(func(ctx context.Context, _ string) (net.Conn, error) {
+			return listener.DialContext(ctx)
+		}),
+		grpc.WithTransportCredentials(insecure.NewCredentials()),
+	)
+}
+
+// serveFakeNode serves node and returns a connection to it
+func serveFakeNode(tb testing.TB, node *fakeNode) *grpc.ClientConn {
+	conn, err := dialFakeNode(listenFakeNode(tb, node))
+	if err != nil {
+		tb.Fatalf("failed to connect to the fake node: %v", err)
+	}
+	tb.Cleanup(func() { conn.Close() })
+	return conn
+}
+
+// newFakeClient returns a client querying nodes in this order of preference
+func newFakeClient(tb testing.TB, nodes ...*fakeNode) *CosmosQueryClient {
+	cqc := &CosmosQueryClient{config: ClientConfig{ContractAddr: "wasm1contract"}}
+	for i, node := range nodes {
+		cqc.endpoints = append(cqc.endpoints, newEndpoint("node"+strconv.Itoa(i), serveFakeNode(tb, node)))
+	}
+	return cqc
+}
+
+func TestPinnedHeightFailover(t *testing.T) {
+	trees := map[string]MerkleTree{"tree-1": {Root: "root", Leaves: []string{"a"}}}
+	synced := &fakeNode{height: 100, trees: trees}
+	lagging := &fakeNode{height: 90, trees: trees}
+	cqc := newFakeClient(t, synced, lagging)
+	ctx := context.Background()
+
+	height, err := cqc.LatestHeight(ctx)
+	if err != nil || height != 100 {
+		t.Fatalf("LatestHeight = %d, %v, want 100", height, err)
+	}
+	queryCtx := AtHeight(ctx, height)
+
+	tree, err := cqc.GetMerkleTreeData(queryCtx, "tree-1")
+	if err != nil || tree.Height != 100 {
+		t.Fatalf("GetMerkleTreeData = %+v, %v, want the tree at 100", tree, err)
+	}
+
+	// The synced node fails: the lagging one must not answer for a block it
+	// has not reached
+	synced.set(100, true)
+	if _, err := cqc.GetMerkleTreeData(queryCtx, "tree-1"); status.Code(err) == codes.OK {
+		t.Error("query pinned at 100 succeeded without a node at 100")
+	}
+	if queries := lagging.queryCount(); queries != 0 {
+		t.Errorf("lagging node received %d queries pinned above its height", queries)
+	}
+
+	// Once the lagging node catches up it takes over
+	lagging.set(101, false)
+	tree, err = cqc.GetMerkleTreeData(queryCtx, "tree-1")
+	if err != nil || tree.Height != 100 {
+		t.Fatalf("GetMerkleTreeData after catch up = %+v, %v, want the tree at 100", tree, err)
+	}
+	if statuses := cqc.Endpoints(); statuses[1].Height != 101 {
+		t.Errorf("lagging node height = %d, want 101", statuses[1].Height)
+	}
+}
+
+func TestPinnedHeightFailoverUnprobed(t *testing.T) {
+	trees := map[string]MerkleTree{"tree-1": {Root: "root", Leaves: []string{"a"}}}
+	primary := &fakeNode{height: 100, trees: trees}
+	secondary := &fakeNode{height: 100, trees: trees}
+	cqc := newFakeClient(t, primary, secondary)
+	ctx := context.Background()
+
+	// Without health checks only the primary has been seen at this height
+	height, err := cqc.LatestHeight(ctx)
+	if err != nil || height != 100 {
+		t.Fatalf("LatestHeight = %d, %v, want 100", height, err)
+	}
+	if statuses := cqc.Endpoints(); statuses[1].Height != 0 {
+		t.Fatalf("secondary height = %d before any query", statuses[1].Height)
+	}
+
+	// The synced secondary takes over mid-cycle once asked for its height
+	primary.set(100, true)
+	tree, err := cqc.GetMerkleTreeData(AtHeight(ctx, height), "tree-1")
+	if err != nil || tree.Height != 100 {
+		t.Fatalf("GetMerkleTreeData = %+v, %v, want the tree at 100", tree, err)
+	}
+	if queries := secondary.queryCount(); queries != 1 {
+		t.Errorf("secondary received %d queries, want 1", queries)
+	}
+	if statuses := cqc.Endpoints(); statuses[1].Height != 100 {
+		t.Errorf("secondary height = %d, want 100", statuses[1].Height)
+	}
+}
+
+func TestUnpinnedFailover(t *testing.T) {
+	trees := map[string]MerkleTree{"tree-1": {Root: "root"}}
+	first := &fakeNode{height: 100, down: true, trees: trees}
+	second := &fakeNode{height: 90, trees: trees}
+	cqc := newFakeClient(t, first, second)
+
+	// Without a pinned height any node may answer
+	tree, err := cqc.GetMerkleTreeData(context.Background(), "tree-1")
+	if err != nil || tree.Height != 90 {
+		t.Fatalf("GetMerkleTreeData = %+v, %v, want the tree at 90", tree, err)
+	}
+	if statuses := cqc.Endpoints(); statuses[0].Healthy || !statuses[1].Healthy {
+		t.Errorf("endpoint health = %+v", statuses)
+	}
+}
@@ -0,0 +1,197 @@
+package clients
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/url"
+	"strings"
+	"sync"
+	"time"
+
+	"github.com/gorilla/websocket"
+)
+
+const (
+	// Timeout of the connection and subscription handshake
+	subscribeTimeout = 10 * time.Second
+	// CometBFT pings every 27 seconds, a connection silent for longer is dead
+	eventReadTimeout = time.Minute
+)
+
+// Event attributes naming the tree a contract execution changed
+var treeIdAttributes = []string{"wasm.tree_id", "wasm.id"}
+
+type rpcRequest struct {
+	JSONRPC string      `json:"jsonrpc"`
+	ID      int         `json:"id"`
+	Method  string      `json:"method"`
+	Params  interface{} `json:"params"`
+}
+
+type rpcResponse struct {
+	Result json.RawMessage `json:"result"`
+	Error  *struct {
+		Code    int    `json:"code"`
+		Message string `json:"message"`
+		Data    string `json:"data"`
+	} `json:"error"`
+}
+
+type resultEvent struct {
+	Query  string              `json:"query"`
+	Events map[string][]string `json:"events"`
+}
+
+// ContractSubscription streams the executions of a contract, received from
+// the WebSocket of a CometBFT RPC node
+type ContractSubscription struct {
+	conn    *websocket.Conn
+	changes chan []string
+	once    sync.Once
+	err     error
+}
+
+// SubscribeContractEvents subscribes to the transactions executing
+// contractAddr. rpcURL is the CometBFT RPC address, such as
+// http://localhost:26657; its /websocket endpoint is used.
+func SubscribeContractEvents(ctx context.Context, rpcURL, contractAddr string) (*ContractSubscription, error) {
+	endpoint, err := websocketURL(rpcURL)
+	if err != nil {
+		return nil, err
+	}
+
+	dialCtx, cancel := context.WithTimeout(ctx, subscribeTimeout)
+	defer cancel()
+	conn, _, err := websocket.DefaultDialer.DialContext(dialCtx, endpoint, nil)
+	if err != nil {
+		return nil, fmt.Errorf("failed to connect to %s: %v", endpoint, err)
+	}
+
+	query := fmt.Sprintf("tm.event='Tx' AND wasm._contract_address='%s'", contractAddr)
+	conn.SetWriteDeadline(time.Now().Add(subscribeTimeout))
+	err = conn.WriteJSON(rpcRequest{
+		JSONRPC: "2.0",
+		ID:      1,
+		Method:  "subscribe",
+		Params:  map[string]string{"query": query},
+	})
+	if err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe: %v", err)
+	}
+
+	// The first message acknowledges or rejects the subscription
+	conn.SetReadDeadline(time.Now().Add(subscribeTimeout))
+	var ack rpcResponse
+	if err := conn.ReadJSON(&ack); err != nil {
+		conn.Close()
+		return nil, fmt.Errorf("failed to subscribe: %v", err)
+	}
+	if ack.Error != nil {
+		conn.Close()
+		return nil, fmt.Errorf("subscription rejected: %s %s", ack.Error.Message, ack.Error.Data)
+	}
+
+	sub := &ContractSubscription{
+		conn:    conn,
+		changes: make(chan []string, 64),
+	}
+	conn.SetPingHandler(func(data string) error {
+		conn.SetReadDeadline(time.Now().Add(eventReadTimeout))
+		return conn.WriteControl(websocket.PongMessage, []byte(data), time.Now().Add(subscribeTimeout))
+	})
+	go sub.read(ctx)
+	return sub, nil
+}
+
+// websocketURL returns the WebSocket endpoint of a CometBFT RPC address
+func websocketURL(rpcURL string) (string, error) {
+	u, err := url.Parse(rpcURL)
+	if err != nil || u.Host == "" {
+		return "", fmt.Errorf("invalid RPC URL %q", rpcURL)
+	}
+	switch u.Scheme {
+	case "http", "tcp", "ws":
+		u.Scheme = "ws"
+	case "https", "wss":
+		u.Scheme = "wss"
+	default:
+		return "", fmt.Errorf("unsupported RPC URL scheme %q", u.Scheme)
+	}
+	if u.Path == "" || u.Path == "/" {
+		u.Path = "/websocket"
+	}
+	return u.String(), nil
+}
+
+// Changes receives the tree ids changed by every execution of the contract.
+// An empty list means the event did not name a tree, so any tree may have
+// changed. The channel is closed when the subscription ends; Err then tells
+// why.
+func (s *ContractSubscription) Changes() <-chan []string {
+	return s.changes
+}
+
+// Err returns the reason the subscription ended, nil when it was closed
+func (s *ContractSubscription) Err() error {
+	return s.err
+}
+
+// Close ends the subscription
+func (s *ContractSubscription) Close() {
+	s.once.Do(func() {
+		s.conn.Close()
+	})
+}
+
+func (s *ContractSubscription) read(ctx context.Context) {
+	defer close(s.changes)
+	defer s.Close()
+
+	// Unblock the read below when ctx is cancelled
+	stop := context.AfterFunc(ctx, s.Close)
+	defer stop()
+
+	for {
+		s.conn.SetReadDeadline(time.Now().Add(eventReadTimeout))
+		var response rpcResponse
+		if err := s.conn.ReadJSON(&response); err != nil {
+			if ctx.Err() == nil {
+				s.err = fmt.Errorf("subscription dropped: %v", err)
+			}
+			return
+		}
+		if response.Error != nil {
+			s.err = fmt.Errorf("subscription failed: %s %s", response.Error.Message, response.Error.Data)
+			return
+		}
+
+		var event resultEvent
+		if err := json.Unmarshal(response.Result, &event); err != nil {
+			logger.Warn("failed to parse contract event", "error", err)
+			continue
+		}
+
+		select {
+		case s.changes <- treeIds(event.Events):
+		case <-ctx.Done():
+			return
+		}
+	}
+}
+
+// treeIds returns the tree ids named by the attributes of an event
+func treeIds(events map[string][]string) []string {
+	seen := map[string]bool{}
+	ids := []string{}
+	for _, attribute := range treeIdAttributes {
+		for _, id := range events[attribute] {
+			if id = strings.TrimSpace(id); id != "" && !seen[id] {
+				seen[id] = true
+				ids = append(ids, id)
+			}
+		}
+	}
+	return ids
+}
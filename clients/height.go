@@ -0,0 +1,85 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"strconv"
+
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	grpctypes "github.com/cosmos/cosmos-sdk/types/grpc"
+	"google.golang.org/grpc/metadata"
+)
+
+// AtHeight returns a context that pins the contract queries made with it to
+// the state at the given block height, so a tree list and the trees read
+// afterwards come from the same block
+func AtHeight(ctx context.Context, height int64) context.Context {
+	return metadata.AppendToOutgoingContext(ctx, grpctypes.GRPCBlockHeightHeader, strconv.FormatInt(height, 10))
+}
+
+// LatestHeight returns the height of the latest block of the best endpoint,
+// or of the block before when proofs are verified. Queries pinned to it with
+// AtHeight then only go to endpoints that have reached it.
+func (cqc *CosmosQueryClient) LatestHeight(ctx context.Context) (int64, error) {
+	var height int64
+	err := cqc.call(ctx, func(e *endpoint) error {
+		var err error
+		height, err = e.latestHeight(ctx)
+		return err
+	})
+	if err != nil {
+		return 0, fmt.Errorf("failed to query latest block: %v", err)
+	}
+	// The state of a block is committed in the header of the next one, which
+	// proofs need to be checked against
+	if cqc.verifier != nil && height > 1 {
+		height--
+	}
+	return height, nil
+}
+
+// latestHeight asks the endpoint for the height of its latest block and
+// records it
+func (e *endpoint) latestHeight(ctx context.Context) (int64, error) {
+	res, err := e.serviceClient.GetLatestBlock(ctx, &cmtservice.GetLatestBlockRequest{})
+	if err != nil {
+		return 0, err
+	}
+	var height int64
+	switch {
+	case res.SdkBlock != nil:
+		height = res.SdkBlock.Header.Height
+	case res.Block != nil:
+		height = res.Block.Header.Height
+	default:
+		return 0, fmt.Errorf("latest block response has no block")
+	}
+	e.observeHeight(height)
+	return height, nil
+}
+
+// unpinned returns ctx without the block height set by AtHeight, which a node
+// rejects on any query while it has not reached that height
+func unpinned(ctx context.Context) context.Context {
+	md, ok := metadata.FromOutgoingContext(ctx)
+	if !ok {
+		return ctx
+	}
+	md = md.Copy()
+	md.Delete(grpctypes.GRPCBlockHeightHeader)
+	return metadata.NewOutgoingContext(ctx, md)
+}
+
+// headerHeight returns the block height a query was answered at, or 0 when
+// the node did not report it
+func headerHeight(header metadata.MD) int64 {
+	values := header.Get(grpctypes.GRPCBlockHeightHeader)
+	if len(values) == 0 {
+		return 0
+	}
+	height, err := strconv.ParseInt(values[0], 10, 64)
+	if err != nil {
+		return 0
+	}
+	return height
+}
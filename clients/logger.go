@@ -0,0 +1,10 @@
+package clients
+
+import "log/slog"
+
+var logger = slog.Default()
+
+// SetLogger replaces the logger used by the clients package
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
@@ -0,0 +1,143 @@
+package clients
+
+import (
+	"cmp"
+	"encoding/json"
+	"slices"
+	"strings"
+)
+
+// TreeMetadata is the structured form of MerkleTree.Metadata, when the
+// contract stores it as a JSON object. Fields missing from the object are
+// left zero.
+type TreeMetadata struct {
+	CreatedHeight int64    `json:"created_height,omitempty"` // Block height the tree was created at
+	Owner         string   `json:"owner,omitempty"`          // Address of the tree owner
+	LeafCount     int      `json:"leaf_count,omitempty"`     // Number of leaves announced by the owner
+	Tags          []string `json:"tags,omitempty"`
+}
+
+// ParseTreeMetadata parses the metadata string of a tree. It returns nil
+// when the metadata is not a JSON object, such as free text.
+func ParseTreeMetadata(metadata string) *TreeMetadata {
+	metadata = strings.TrimSpace(metadata)
+	if !strings.HasPrefix(metadata, "{") {
+		return nil
+	}
+
+	var parsed TreeMetadata
+	if err := json.Unmarshal([]byte(metadata), &parsed); err != nil {
+		logger.Debug("tree metadata is not valid JSON", "error", err)
+		return nil
+	}
+	return &parsed
+}
+
+// HasTag reports whether the metadata carries tag, ignoring case
+func (m *TreeMetadata) HasTag(tag string) bool {
+	if m == nil {
+		return false
+	}
+	return slices.ContainsFunc(m.Tags, func(t string) bool {
+		return strings.EqualFold(t, tag)
+	})
+}
+
+// WithoutTags selects the trees carrying none of tags
+func WithoutTags(tags []string) TreeFilter {
+	return func(tree *MerkleTree) bool {
+		for _, tag := range tags {
+			if tree.Info.HasTag(tag) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// OwnedBy selects the trees whose metadata names one of owners. Bech32 and
+// hex addresses are compared ignoring case, like the other address
+// comparisons.
+func OwnedBy(owners []string) TreeFilter {
+	return func(tree *MerkleTree) bool {
+		if tree.Info == nil {
+			return false
+		}
+		owner := strings.TrimSpace(tree.Info.Owner)
+		return owner != "" && slices.ContainsFunc(owners, func(o string) bool {
+			return strings.EqualFold(strings.TrimSpace(o), owner)
+		})
+	}
+}
+
+// AllOf selects the trees selected by every filter
+func AllOf(filters ...TreeFilter) TreeFilter {
+	return func(tree *MerkleTree) bool {
+		for _, filter := range filters {
+			if !filter(tree) {
+				return false
+			}
+		}
+		return true
+	}
+}
+
+// TreeOrder compares two trees, as slices.SortStableFunc expects, to decide
+// which one is worked on first
+type TreeOrder func(a, b *MerkleTree) int
+
+// PreferTags puts first the trees carrying the earliest of tags, then the
+// trees carrying none of them
+func PreferTags(tags []string) TreeOrder {
+	rank := func(tree *MerkleTree) int {
+		for i, tag := range tags {
+			if tree.Info.HasTag(tag) {
+				return i
+			}
+		}
+		return len(tags)
+	}
+	return func(a, b *MerkleTree) int {
+		return cmp.Compare(rank(a), rank(b))
+	}
+}
+
+// ByCreatedHeight orders the trees by creation height, the newest first when
+// newestFirst is set. Trees without a creation height come last.
+func ByCreatedHeight(newestFirst bool) TreeOrder {
+	return func(a, b *MerkleTree) int {
+		ha, hb := createdHeight(a), createdHeight(b)
+		switch {
+		case ha == hb:
+			return 0
+		case ha == 0:
+			return 1
+		case hb == 0:
+			return -1
+		case newestFirst:
+			return cmp.Compare(hb, ha)
+		default:
+			return cmp.Compare(ha, hb)
+		}
+	}
+}
+
+func createdHeight(tree *MerkleTree) int64 {
+	if tree.Info == nil {
+		return 0
+	}
+	return tree.Info.CreatedHeight
+}
+
+// Ordered orders the trees by orders, each one breaking the ties of the
+// previous ones
+func Ordered(orders ...TreeOrder) TreeOrder {
+	return func(a, b *MerkleTree) int {
+		for _, order := range orders {
+			if c := order(a, b); c != 0 {
+				return c
+			}
+		}
+		return 0
+	}
+}
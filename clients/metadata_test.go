@@ -0,0 +1,106 @@
+package clients
+
+import (
+	"reflect"
+	"slices"
+	"testing"
+)
+
+func TestParseTreeMetadata(t *testing.T) {
+	tests := []struct {
+		name     string
+		metadata string
+		want     *TreeMetadata
+	}{
+		{"empty", "", nil},
+		{"blank", "   ", nil},
+		{"free text", "daily batch", nil},
+		{"JSON array", `["daily"]`, nil},
+		{"JSON string", `"daily"`, nil},
+		{"truncated object", `{"owner":"wasm1owner"`, nil},
+		{"trailing data", `{"owner":"wasm1owner"} extra`, nil},
+		{"wrong field type", `{"leaf_count":"three"}`, nil},
+		{"wrong tags type", `{"tags":"daily"}`, nil},
+		{"empty object", `{}`, &TreeMetadata{}},
+		{"null fields", `{"owner":null,"tags":null}`, &TreeMetadata{}},
+		{"unknown fields", `{"owner":"wasm1owner","color":"blue"}`, &TreeMetadata{Owner: "wasm1owner"}},
+		{
+			"every field",
+			` {"created_height":123,"owner":"wasm1owner","leaf_count":3,"tags":["daily","Priority"]} `,
+			&TreeMetadata{CreatedHeight: 123, Owner: "wasm1owner", LeafCount: 3, Tags: []string{"daily", "Priority"}},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			if got := ParseTreeMetadata(tt.metadata); !reflect.DeepEqual(got, tt.want) {
+				t.Errorf("ParseTreeMetadata(%q) = %+v, want %+v", tt.metadata, got, tt.want)
+			}
+		})
+	}
+}
+
+func treeWith(id, metadata string) *MerkleTree {
+	return &MerkleTree{ID: id, Metadata: metadata, Info: ParseTreeMetadata(metadata)}
+}
+
+func TestTreeFilters(t *testing.T) {
+	tagged := treeWith("tagged", `{"owner":"wasm1qy352eufqy352eufqy352eufqy35qqqz9ayrkz","tags":["Deprecated"]}`)
+	hexOwned := treeWith("hex", `{"owner":"0x2c7536e3605d9c16a7a3d7b1898e529396a65c23"}`)
+	text := treeWith("text", "daily batch")
+
+	withoutTags := WithoutTags([]string{"deprecated"})
+	if withoutTags(tagged) || !withoutTags(hexOwned) || !withoutTags(text) {
+		t.Error("WithoutTags does not skip exactly the tagged tree")
+	}
+
+	ownedBy := OwnedBy([]string{" WASM1QY352EUFQY352EUFQY352EUFQY35QQQZ9AYRKZ", "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"})
+	if !ownedBy(tagged) || !ownedBy(hexOwned) || ownedBy(text) {
+		t.Error("OwnedBy does not compare owners ignoring case")
+	}
+	if OwnedBy([]string{""})(treeWith("no owner", `{}`)) {
+		t.Error("OwnedBy selected a tree without owner")
+	}
+
+	if AllOf(withoutTags, ownedBy)(tagged) || !AllOf(withoutTags, ownedBy)(hexOwned) {
+		t.Error("AllOf does not require every filter")
+	}
+}
+
+func TestTreeOrder(t *testing.T) {
+	trees := []*MerkleTree{
+		treeWith("text", "daily batch"),
+		treeWith("old", `{"created_height":10}`),
+		treeWith("daily", `{"created_height":20,"tags":["daily"]}`),
+		treeWith("new", `{"created_height":30}`),
+		treeWith("priority", `{"created_height":5,"tags":["PRIORITY"]}`),
+		treeWith("new daily", `{"created_height":40,"tags":["daily"]}`),
+	}
+
+	tests := []struct {
+		name  string
+		order TreeOrder
+		want  []string
+	}{
+		{"newest", ByCreatedHeight(true), []string{"new daily", "new", "daily", "old", "priority", "text"}},
+		{"oldest", ByCreatedHeight(false), []string{"priority", "old", "daily", "new", "new daily", "text"}},
+		{"tags", PreferTags([]string{"priority", "daily"}), []string{"priority", "daily", "new daily", "text", "old", "new"}},
+		{
+			"tags then newest",
+			Ordered(PreferTags([]string{"priority", "daily"}), ByCreatedHeight(true)),
+			[]string{"priority", "new daily", "daily", "new", "old", "text"},
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			sorted := slices.Clone(trees)
+			slices.SortStableFunc(sorted, tt.order)
+			var ids []string
+			for _, tree := range sorted {
+				ids = append(ids, tree.ID)
+			}
+			if !slices.Equal(ids, tt.want) {
+				t.Errorf("order = %v, want %v", ids, tt.want)
+			}
+		})
+	}
+}
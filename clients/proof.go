@@ -0,0 +1,215 @@
+package clients
+
+import (
+	"context"
+	"encoding/binary"
+	"encoding/json"
+	"fmt"
+	"sync"
+	"time"
+
+	wasmtypes "github.com/CosmWasm/wasmd/x/wasm/types"
+	dbm "github.com/cometbft/cometbft-db"
+	"github.com/cometbft/cometbft/light"
+	lightdb "github.com/cometbft/cometbft/light/store/db"
+	cmttypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	ics23 "github.com/cosmos/ics23/go"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+const (
+	// Store of the wasm module in the multistore of the chain
+	wasmStoreKey = "wasm"
+	// Timeout of fetching and checking the trusted header at startup
+	lightClientInitTimeout = 30 * time.Second
+	// Proof operation types of the IAVL store and of the multistore
+	iavlProofOpType  = "ics23:iavl"
+	storeProofOpType = "ics23:simple"
+)
+
+// ProofConfig enables the verification of the trees read from the contract.
+// Trees are then read from the raw contract storage with ICS23 proofs, which
+// are checked against the app hash of headers verified by a CometBFT light
+// client, so no gRPC or RPC node has to be trusted. The list of tree ids is
+// still taken from the contract query: a node can hide trees but not forge
+// them.
+type ProofConfig struct {
+	Enabled        bool
+	ChainID        string
+	RPCURL         string        // Primary CometBFT RPC of the light client
+	Witnesses      []string      // CometBFT RPCs cross-checking the primary, at least one
+	TrustedHeight  int64         // Height of a header trusted out of band
+	TrustedHash    []byte        // Hash of the trusted header
+	TrustingPeriod time.Duration // Must be shorter than the unbonding period of the chain
+	TreeNamespace  string        // Storage namespace of the tree map of the contract
+}
+
+// lightClient verifies headers, as *light.Client does
+type lightClient interface {
+	VerifyLightBlockAtHeight(ctx context.Context, height int64, now time.Time) (*cmttypes.LightBlock, error)
+}
+
+// stateVerifier checks contract storage proofs against light client headers
+type stateVerifier struct {
+	mu       sync.Mutex // Serializes the light client
+	light    lightClient
+	prefix   []byte // Storage prefix of the contract in the wasm store
+	treeKeys []byte // Length prefixed namespace of the tree map
+}
+
+func newStateVerifier(ctx context.Context, config ProofConfig, contractAddr string) (*stateVerifier, error) {
+	verifier, err := newStateKeys(contractAddr, config.TreeNamespace)
+	if err != nil {
+		return nil, err
+	}
+
+	verifier.light, err = light.NewHTTPClient(ctx, config.ChainID,
+		light.TrustOptions{
+			Period: config.TrustingPeriod,
+			Height: config.TrustedHeight,
+			Hash:   config.TrustedHash,
+		},
+		config.RPCURL, config.Witnesses,
+		lightdb.New(dbm.NewMemDB(), config.ChainID),
+	)
+	if err != nil {
+		return nil, fmt.Errorf("failed to start light client: %v", err)
+	}
+	return verifier, nil
+}
+
+// newStateKeys returns a verifier without light client, only able to build
+// the storage keys of the trees of the contract
+func newStateKeys(contractAddr, treeNamespace string) (*stateVerifier, error) {
+	_, address, err := bech32.DecodeAndConvert(contractAddr)
+	if err != nil {
+		return nil, fmt.Errorf("invalid contract address %s: %v", contractAddr, err)
+	}
+
+	// cw-storage-plus stores a map entry under the length prefixed namespace
+	// followed by the key
+	namespace := make([]byte, 2, 2+len(treeNamespace))
+	binary.BigEndian.PutUint16(namespace, uint16(len(treeNamespace)))
+	namespace = append(namespace, treeNamespace...)
+
+	return &stateVerifier{
+		prefix:   wasmtypes.GetContractStorePrefix(address),
+		treeKeys: namespace,
+	}, nil
+}
+
+// treeKey returns the key of a tree in the wasm store
+func (v *stateVerifier) treeKey(id string) []byte {
+	key := make([]byte, 0, len(v.prefix)+len(v.treeKeys)+len(id))
+	return append(append(append(key, v.prefix...), v.treeKeys...), id...)
+}
+
+// appHash returns the app hash committing to the state at height, found in
+// the verified header of the next block
+func (v *stateVerifier) appHash(ctx context.Context, height int64) ([]byte, error) {
+	v.mu.Lock()
+	defer v.mu.Unlock()
+
+	block, err := v.light.VerifyLightBlockAtHeight(ctx, height+1, time.Now())
+	if err != nil {
+		return nil, fmt.Errorf("failed to verify header %d: %v", height+1, err)
+	}
+	return block.AppHash, nil
+}
+
+// verifyProofOps checks that proof proves key is set to value in the wasm
+// store, or is absent from it when value is empty, and that the wasm store is
+// committed in appHash
+func verifyProofOps(proof *cmtservice.ProofOps, appHash, key, value []byte) error {
+	if proof == nil || len(proof.Ops) != 2 {
+		return fmt.Errorf("expected an iavl and a store proof")
+	}
+	if proof.Ops[0].Type != iavlProofOpType || proof.Ops[1].Type != storeProofOpType {
+		return fmt.Errorf("unexpected proof types %s and %s", proof.Ops[0].Type, proof.Ops[1].Type)
+	}
+
+	var storeProof, rootProof ics23.CommitmentProof
+	if err := storeProof.Unmarshal(proof.Ops[0].Data); err != nil {
+		return fmt.Errorf("invalid store proof: %v", err)
+	}
+	if err := rootProof.Unmarshal(proof.Ops[1].Data); err != nil {
+		return fmt.Errorf("invalid root proof: %v", err)
+	}
+
+	storeRoot, err := storeProof.Calculate()
+	if err != nil {
+		return fmt.Errorf("invalid store proof: %v", err)
+	}
+	if len(value) == 0 {
+		if !ics23.VerifyNonMembership(ics23.IavlSpec, storeRoot, &storeProof, key) {
+			return fmt.Errorf("store proof does not prove the key is absent")
+		}
+	} else if !ics23.VerifyMembership(ics23.IavlSpec, storeRoot, &storeProof, key, value) {
+		return fmt.Errorf("store proof does not prove the key")
+	}
+	if !ics23.VerifyMembership(ics23.TendermintSpec, appHash, &rootProof, []byte(wasmStoreKey), storeRoot) {
+		return fmt.Errorf("store is not committed in the app hash")
+	}
+	return nil
+}
+
+// fetchProvenMerkleTree reads a tree from the contract storage at the height
+// pinned in ctx and verifies it against the light client
+func (cqc *CosmosQueryClient) fetchProvenMerkleTree(ctx context.Context, id string) (*MerkleTree, error) {
+	height := pinnedHeight(ctx)
+	if height == 0 {
+		var err error
+		if height, err = cqc.LatestHeight(ctx); err != nil {
+			return nil, err
+		}
+	}
+
+	appHash, err := cqc.verifier.appHash(ctx, height)
+	if err != nil {
+		return nil, err
+	}
+
+	key := cqc.verifier.treeKey(id)
+	var res *cmtservice.ABCIQueryResponse
+	err = cqc.call(ctx, func(e *endpoint) error {
+		var err error
+		res, err = e.serviceClient.ABCIQuery(ctx, &cmtservice.ABCIQueryRequest{
+			Path:   "/store/" + wasmStoreKey + "/key",
+			Data:   key,
+			Height: height,
+			Prove:  true,
+		})
+		if err != nil {
+			return err
+		}
+		// A proven query answers a missing key with a proof of absence, so a
+		// failed query comes from the endpoint, which is failed over
+		if res.Code != 0 {
+			return status.Errorf(codes.Unavailable, "contract storage query failed with code %d: %s", res.Code, res.Log)
+		}
+		// An endpoint answering with a bad proof is failed over like an
+		// unavailable one
+		if err := verifyProofOps(res.ProofOps, appHash, key, res.Value); err != nil {
+			return status.Errorf(codes.DataLoss, "invalid proof of tree %s at height %d: %v", id, height, err)
+		}
+		return nil
+	})
+	if err != nil {
+		return nil, fmt.Errorf("failed to query contract storage: %v", err)
+	}
+	if len(res.Value) == 0 {
+		return nil, fmt.Errorf("tree %s does not exist at height %d", id, height)
+	}
+
+	var tree MerkleTree
+	if err := json.Unmarshal(res.Value, &tree); err != nil {
+		return nil, fmt.Errorf("failed to unmarshal stored tree: %v", err)
+	}
+	tree.ID = id
+	tree.Info = ParseTreeMetadata(tree.Metadata)
+	tree.Height = height
+	return &tree, nil
+}
@@ -0,0 +1,354 @@
+package clients
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha256"
+	"encoding/json"
+	"slices"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+
+	"cosmossdk.io/log"
+	storetypes "cosmossdk.io/store/types"
+	cmtprotocrypto "github.com/cometbft/cometbft/proto/tendermint/crypto"
+	cmttypes "github.com/cometbft/cometbft/types"
+	"github.com/cosmos/cosmos-sdk/client/grpc/cmtservice"
+	"github.com/cosmos/cosmos-sdk/types/bech32"
+	"github.com/cosmos/iavl"
+	idb "github.com/cosmos/iavl/db"
+	"google.golang.org/grpc/codes"
+	"google.golang.org/grpc/status"
+)
+
+// proofFixture is a wasm store committed in a multistore, answering proven
+// queries the way a node does
+type proofFixture struct {
+	store   *iavl.ImmutableTree
+	info    storetypes.CommitInfo
+	appHash []byte
+}
+
+func newProofFixture(t *testing.T, entries map[string][]byte) *proofFixture {
+	tree := iavl.NewMutableTree(idb.NewMemDB(), 100, false, log.NewNopLogger())
+	for key, value := range entries {
+		if _, err := tree.Set([]byte(key), value); err != nil {
+			t.Fatalf("failed to set %x: %v", key, err)
+		}
+	}
+	_, version, err := tree.SaveVersion()
+	if err != nil {
+		t.Fatalf("failed to save the store: %v", err)
+	}
+	store, err := tree.GetImmutable(version)
+	if err != nil {
+		t.Fatalf("failed to load the store: %v", err)
+	}
+
+	// The wasm store among the other stores of the chain
+	storeInfo := func(name string, hash []byte) storetypes.StoreInfo {
+		return storetypes.StoreInfo{Name: name, CommitId: storetypes.CommitID{Version: version, Hash: hash}}
+	}
+	bankHash, stakingHash := sha256.Sum256([]byte("bank")), sha256.Sum256([]byte("staking"))
+	info := storetypes.CommitInfo{
+		Version: version,
+		StoreInfos: []storetypes.StoreInfo{
+			storeInfo("bank", bankHash[:]),
+			storeInfo(wasmStoreKey, store.Hash()),
+			storeInfo("staking", stakingHash[:]),
+		},
+	}
+	return &proofFixture{store: store, info: info, appHash: info.Hash()}
+}
+
+// query answers a proven query of key in the wasm store, with a proof of
+// absence when key is not set
+func (f *proofFixture) query(t *testing.T, key []byte) *cmtservice.ABCIQueryResponse {
+	value, err := f.store.Get(key)
+	if err != nil {
+		t.Fatalf("failed to get %x: %v", key, err)
+	}
+	proof, err := f.store.GetProof(key)
+	if err != nil {
+		t.Fatalf("failed to prove %x: %v", key, err)
+	}
+
+	ops := &cmtservice.ProofOps{}
+	for _, op := range []cmtprotocrypto.ProofOp{
+		storetypes.NewIavlCommitmentOp(key, proof).ProofOp(),
+		f.info.ProofOp(wasmStoreKey),
+	} {
+		ops.Ops = append(ops.Ops, cmtservice.ProofOp{Type: op.Type, Key: op.Key, Data: op.Data})
+	}
+	return &cmtservice.ABCIQueryResponse{Key: key, Value: value, ProofOps: ops}
+}
+
+// testContract is a bech32 contract address with a known payload
+func testContract(t *testing.T) (string, []byte) {
+	address := bytes.Repeat([]byte{0xab}, 32)
+	contractAddr, err := bech32.ConvertAndEncode("wasm", address)
+	if err != nil {
+		t.Fatalf("failed to encode the contract address: %v", err)
+	}
+	return contractAddr, address
+}
+
+func TestTreeKey(t *testing.T) {
+	contractAddr, address := testContract(t)
+	verifier, err := newStateKeys(contractAddr, "trees")
+	if err != nil {
+		t.Fatalf("newStateKeys: %v", err)
+	}
+
+	// Contract store prefix, contract address, then the cw-storage-plus map
+	// key: the length prefixed namespace followed by the tree id
+	want := append([]byte{0x03}, address...)
+	want = append(want, 0x00, 0x05)
+	want = append(want, "trees"...)
+	want = append(want, "tree-1"...)
+	if key := verifier.treeKey("tree-1"); !bytes.Equal(key, want) {
+		t.Errorf("treeKey = %x, want %x", key, want)
+	}
+
+	// Keys of different trees do not share the backing array of the prefix
+	a, b := verifier.treeKey("a"), verifier.treeKey("b")
+	if a[len(a)-1] != 'a' || b[len(b)-1] != 'b' {
+		t.Errorf("treeKey(a) = %x, treeKey(b) = %x", a, b)
+	}
+
+	if _, err := newStateKeys("wasm1invalid", "trees"); err == nil {
+		t.Error("newStateKeys accepted an invalid contract address")
+	}
+}
+
+func TestVerifyProofOps(t *testing.T) {
+	contractAddr, _ := testContract(t)
+	verifier, err := newStateKeys(contractAddr, "trees")
+	if err != nil {
+		t.Fatalf("newStateKeys: %v", err)
+	}
+	key, otherKey, absentKey := verifier.treeKey("tree-1"), verifier.treeKey("tree-2"), verifier.treeKey("tree-3")
+	value := []byte(`{"root":"root-1","leaves":["a"]}`)
+	fixture := newProofFixture(t, map[string][]byte{
+		string(key):      value,
+		string(otherKey): []byte(`{"root":"root-2","leaves":["b"]}`),
+		"other":          []byte("other contract state"),
+	})
+	otherChain := newProofFixture(t, map[string][]byte{string(key): value})
+
+	present, absent := fixture.query(t, key), fixture.query(t, absentKey)
+	if !bytes.Equal(present.Value, value) || len(absent.Value) != 0 {
+		t.Fatalf("fixture answered %q and %q", present.Value, absent.Value)
+	}
+
+	// proofOps returns a copy of the proof of res modified by edit
+	proofOps := func(res *cmtservice.ABCIQueryResponse, edit func(ops []cmtservice.ProofOp) []cmtservice.ProofOp) *cmtservice.ProofOps {
+		ops := slices.Clone(res.ProofOps.Ops)
+		for i := range ops {
+			ops[i].Data = bytes.Clone(ops[i].Data)
+		}
+		return &cmtservice.ProofOps{Ops: edit(ops)}
+	}
+
+	tests := []struct {
+		name    string
+		proof   *cmtservice.ProofOps
+		appHash []byte
+		key     []byte
+		value   []byte
+		wantErr string // Empty when the proof is valid
+	}{
+		{name: "valid", proof: present.ProofOps, appHash: fixture.appHash, key: key, value: value},
+		{name: "valid absence", proof: absent.ProofOps, appHash: fixture.appHash, key: absentKey},
+		{
+			name: "tampered value", proof: present.ProofOps, appHash: fixture.appHash, key: key,
+			value: []byte(`{"root":"forged","leaves":["a"]}`), wantErr: "does not prove the key",
+		},
+		{
+			name: "tampered proof", appHash: fixture.appHash, key: key, value: value, wantErr: "not committed in the app hash",
+			proof: proofOps(present, func(ops []cmtservice.ProofOp) []cmtservice.ProofOp {
+				ops[0].Data[len(ops[0].Data)-1] ^= 0xff
+				return ops
+			}),
+		},
+		{name: "wrong key", proof: present.ProofOps, appHash: fixture.appHash, key: otherKey, value: value, wantErr: "does not prove the key"},
+		{name: "absence of a present key", proof: present.ProofOps, appHash: fixture.appHash, key: key, wantErr: "does not prove the key is absent"},
+		{name: "value of an absent key", proof: absent.ProofOps, appHash: fixture.appHash, key: absentKey, value: value, wantErr: "does not prove the key"},
+		{name: "wrong app hash", proof: present.ProofOps, appHash: otherChain.appHash, key: key, value: value, wantErr: "not committed in the app hash"},
+		{name: "missing proof", appHash: fixture.appHash, key: key, value: value, wantErr: "expected an iavl and a store proof"},
+		{
+			name: "missing store proof op", appHash: fixture.appHash, key: key, value: value, wantErr: "expected an iavl and a store proof",
+			proof: proofOps(present, func(ops []cmtservice.ProofOp) []cmtservice.ProofOp { return ops[:1] }),
+		},
+		{
+			name: "missing iavl proof op", appHash: fixture.appHash, key: key, value: value, wantErr: "expected an iavl and a store proof",
+			proof: proofOps(present, func(ops []cmtservice.ProofOp) []cmtservice.ProofOp { return ops[1:] }),
+		},
+		{
+			name: "swapped proof ops", appHash: fixture.appHash, key: key, value: value, wantErr: "unexpected proof types",
+			proof: proofOps(present, func(ops []cmtservice.ProofOp) []cmtservice.ProofOp {
+				return []cmtservice.ProofOp{ops[1], ops[0]}
+			}),
+		},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := verifyProofOps(tt.proof, tt.appHash, tt.key, tt.value)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("verifyProofOps: %v", err)
+			case tt.wantErr != "" && err == nil:
+				t.Error("verifyProofOps accepted the proof")
+			case tt.wantErr != "" && !strings.Contains(err.Error(), tt.wantErr):
+				t.Errorf("verifyProofOps = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// fakeLight serves the app hash of a fixture as verified, recording the
+// requested heights
+type fakeLight struct {
+	mu      sync.Mutex
+	appHash []byte
+	heights []int64
+}
+
+func (l *fakeLight) VerifyLightBlockAtHeight(ctx context.Context, height int64, now time.Time) (*cmttypes.LightBlock, error) {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+	l.heights = append(l.heights, height)
+	return &cmttypes.LightBlock{SignedHeader: &cmttypes.SignedHeader{Header: &cmttypes.Header{Height: height, AppHash: l.appHash}}}, nil
+}
+
+func (n *fakeNode) ABCIQuery(ctx context.Context, request *cmtservice.ABCIQueryRequest) (*cmtservice.ABCIQueryResponse, error) {
+	n.mu.Lock()
+	defer n.mu.Unlock()
+
+	n.queries++
+	if n.down {
+		return nil, status.Error(codes.Unavailable, "node is down")
+	}
+	if request.Height > n.height {
+		return nil, status.Errorf(codes.InvalidArgument, "cannot query with height in the future; please provide a valid height")
+	}
+	res := n.storage(request)
+	res.Height = request.Height
+	return res, nil
+}
+
+func TestFetchProvenMerkleTree(t *testing.T) {
+	contractAddr, _ := testContract(t)
+	verifier, err := newStateKeys(contractAddr, "trees")
+	if err != nil {
+		t.Fatalf("newStateKeys: %v", err)
+	}
+	stored := MerkleTree{Root: "root-1", Leaves: []string{"a", "b"}, Metadata: `{"tags":["daily"]}`}
+	value, _ := json.Marshal(stored)
+	fixture := newProofFixture(t, map[string][]byte{string(verifier.treeKey("tree-1")): value})
+
+	honest := func(request *cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse {
+		return fixture.query(t, request.Data)
+	}
+	forging := func(request *cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse {
+		res := fixture.query(t, request.Data)
+		res.Value = []byte(`{"root":"forged","leaves":["a","b"]}`)
+		return res
+	}
+	hiding := func(request *cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse {
+		return &cmtservice.ABCIQueryResponse{Code: 1, Log: "internal error"}
+	}
+	unproven := func(request *cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse {
+		res := fixture.query(t, request.Data)
+		res.ProofOps = nil
+		return res
+	}
+
+	// newClient queries one node per storage behaviour, in this order
+	newClient := func(t *testing.T, storages ...func(*cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse) (*CosmosQueryClient, []*fakeNode, *fakeLight) {
+		var nodes []*fakeNode
+		for _, storage := range storages {
+			nodes = append(nodes, &fakeNode{height: 101, storage: storage})
+		}
+		cqc := newFakeClient(t, nodes...)
+		light := &fakeLight{appHash: fixture.appHash}
+		cqc.verifier = &stateVerifier{light: light, prefix: verifier.prefix, treeKeys: verifier.treeKeys}
+		return cqc, nodes, light
+	}
+
+	t.Run("proven tree", func(t *testing.T) {
+		cqc, _, light := newClient(t, honest)
+
+		// The latest block with a next header is pinned, and its state is
+		// checked against the app hash of the next header
+		tree, err := cqc.fetchProvenMerkleTree(context.Background(), "tree-1")
+		if err != nil {
+			t.Fatalf("fetchProvenMerkleTree: %v", err)
+		}
+		if tree.ID != "tree-1" || tree.Root != stored.Root || !slices.Equal(tree.Leaves, stored.Leaves) || tree.Height != 100 {
+			t.Errorf("tree = %+v, want %+v at height 100", tree, stored)
+		}
+		if tree.Info == nil || !slices.Equal(tree.Info.Tags, []string{"daily"}) {
+			t.Errorf("tree metadata = %+v", tree.Info)
+		}
+		if !slices.Equal(light.heights, []int64{101}) {
+			t.Errorf("verified headers %v, want 101", light.heights)
+		}
+	})
+
+	t.Run("failover", func(t *testing.T) {
+		cqc, nodes, _ := newClient(t, forging, hiding, unproven, honest)
+		// Every node has reached the pinned height
+		for _, e := range cqc.endpoints {
+			e.observeHeight(101)
+		}
+
+		tree, err := cqc.fetchProvenMerkleTree(AtHeight(context.Background(), 100), "tree-1")
+		if err != nil {
+			t.Fatalf("fetchProvenMerkleTree: %v", err)
+		}
+		if tree.Root != stored.Root {
+			t.Errorf("root = %s, want %s", tree.Root, stored.Root)
+		}
+		for i, node := range nodes {
+			if queries := node.queryCount(); queries != 1 {
+				t.Errorf("node %d received %d queries, want 1", i, queries)
+			}
+		}
+		if statuses := cqc.Endpoints(); statuses[0].Healthy || statuses[1].Healthy || statuses[2].Healthy || !statuses[3].Healthy {
+			t.Errorf("endpoint health = %+v", statuses)
+		}
+	})
+
+	t.Run("no valid proof", func(t *testing.T) {
+		cqc, _, _ := newClient(t, forging, hiding)
+		if tree, err := cqc.fetchProvenMerkleTree(context.Background(), "tree-1"); err == nil {
+			t.Fatalf("fetchProvenMerkleTree returned %+v without a valid proof", tree)
+		}
+	})
+
+	t.Run("proven absent tree", func(t *testing.T) {
+		cqc, nodes, _ := newClient(t, honest, honest)
+		_, err := cqc.fetchProvenMerkleTree(context.Background(), "tree-2")
+		if err == nil || !strings.Contains(err.Error(), "tree tree-2 does not exist at height 100") {
+			t.Fatalf("fetchProvenMerkleTree = %v, want the tree to not exist", err)
+		}
+		// A proven absence is an answer, not an endpoint failure
+		if queries := nodes[0].queryCount() + nodes[1].queryCount(); queries != 1 {
+			t.Errorf("nodes received %d queries, want 1", queries)
+		}
+	})
+
+	t.Run("unproven absent tree", func(t *testing.T) {
+		absent := func(request *cmtservice.ABCIQueryRequest) *cmtservice.ABCIQueryResponse {
+			return &cmtservice.ABCIQueryResponse{Key: request.Data}
+		}
+		cqc, _, _ := newClient(t, absent)
+		_, err := cqc.fetchProvenMerkleTree(context.Background(), "tree-1")
+		if err == nil || strings.Contains(err.Error(), "does not exist") {
+			t.Errorf("fetchProvenMerkleTree = %v, want an invalid proof", err)
+		}
+	})
+}
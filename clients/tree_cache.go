@@ -0,0 +1,215 @@
+package clients
+
+import (
+	"container/list"
+	"context"
+	"fmt"
+	"strconv"
+	"sync"
+	"time"
+
+	"golang.org/x/sync/singleflight"
+	"google.golang.org/grpc/metadata"
+)
+
+// Timeout of a fetch shared by the callers of treeCache.get
+const treeFetchTimeout = time.Minute
+
+// treeCache shares the trees fetched by every worker, so N workers cost one
+// fetch per tree root instead of N. Entries are keyed by tree id and root.
+// The contract has no query returning a root without the leaves, so the root
+// of a tree at a block height is looked up in the cache itself: it is the
+// root of the tree read last at or before that height. Contract events drop
+// a tree from the cache as soon as it changes, and ttl bounds how long a
+// change goes unnoticed when events are not subscribed to. Concurrent fetches
+// of a tree at the same height are merged into one, and the least recently
+// used entries are evicted beyond maxTrees trees or maxLeaves leaves.
+type treeCache struct {
+	ttl       time.Duration
+	maxTrees  int
+	maxLeaves int
+	now       func() time.Time
+	group     singleflight.Group
+
+	mu     sync.Mutex
+	roots  map[string]map[string]*list.Element // Entries by tree id and root
+	lru    *list.List                          // Most recently used first
+	leaves int
+}
+
+// treeKey identifies a cached tree
+type treeKey struct {
+	id   string
+	root string
+}
+
+type cachedTree struct {
+	key       treeKey
+	tree      *MerkleTree // Height is the first block height it was read at
+	until     int64       // Height another root was read at, 0 when none
+	fetchedAt time.Time
+}
+
+func newTreeCache(ttl time.Duration, maxTrees, maxLeaves int) *treeCache {
+	return &treeCache{
+		ttl:       ttl,
+		maxTrees:  maxTrees,
+		maxLeaves: maxLeaves,
+		now:       time.Now,
+		roots:     map[string]map[string]*list.Element{},
+		lru:       list.New(),
+	}
+}
+
+// get returns the tree at the height pinned in ctx from the cache, or fetches
+// it once for all concurrent callers. The fetch runs detached from ctx, so a
+// cancelled caller does not fail the others waiting for it. A fetched tree
+// read at another height than the pinned one is rejected.
+func (c *treeCache) get(ctx context.Context, id string, fetch func(ctx context.Context) (*MerkleTree, error)) (*MerkleTree, error) {
+	height := pinnedHeight(ctx)
+	if tree, ok := c.lookup(id, height); ok {
+		return tree, nil
+	}
+
+	fetchCtx := context.WithoutCancel(ctx)
+	result := c.group.DoChan(id+"@"+strconv.FormatInt(height, 10), func() (interface{}, error) {
+		ctx, cancel := context.WithTimeout(fetchCtx, treeFetchTimeout)
+		defer cancel()
+
+		tree, err := fetch(ctx)
+		if err != nil {
+			return nil, err
+		}
+		if height > 0 && tree.Height != height {
+			return nil, fmt.Errorf("tree %s was read at height %d instead of %d", id, tree.Height, height)
+		}
+		c.store(tree)
+		return tree, nil
+	})
+	select {
+	case <-ctx.Done():
+		return nil, ctx.Err()
+	case res := <-result:
+		if res.Err != nil {
+			return nil, res.Err
+		}
+		return copyTree(res.Val.(*MerkleTree)), nil
+	}
+}
+
+// lookup returns the tree read last at or before height, or the tree read
+// last when height is 0
+func (c *treeCache) lookup(id string, height int64) (*MerkleTree, bool) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	var latest *list.Element
+	for _, element := range c.roots[id] {
+		entry := element.Value.(*cachedTree)
+		if c.now().Sub(entry.fetchedAt) > c.ttl {
+			c.remove(element)
+			continue
+		}
+		// A tree read after the pinned height may not exist yet at it, and
+		// one replaced before it is outdated
+		if height > 0 && (entry.tree.Height == 0 || entry.tree.Height > height) {
+			continue
+		}
+		if entry.until > 0 && (height == 0 || height >= entry.until) {
+			continue
+		}
+		if latest == nil || entry.tree.Height > latest.Value.(*cachedTree).tree.Height {
+			latest = element
+		}
+	}
+	if latest == nil {
+		return nil, false
+	}
+	c.lru.MoveToFront(latest)
+	return copyTree(latest.Value.(*cachedTree).tree), true
+}
+
+// store caches a fetched tree. A root already cached keeps the height it was
+// first read at, so it serves every height since. Other roots of the tree
+// read before are replaced by it, and it is itself only valid up to the
+// height of a root read after.
+func (c *treeCache) store(tree *MerkleTree) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	key := treeKey{id: tree.ID, root: tree.Root}
+	entry := &cachedTree{key: key, tree: tree, fetchedAt: c.now()}
+	for root, element := range c.roots[key.id] {
+		other := element.Value.(*cachedTree)
+		switch {
+		case root == key.root:
+			if other.tree.Height > 0 && other.tree.Height < tree.Height {
+				entry.tree, entry.until = other.tree, other.until
+			}
+			c.remove(element)
+		case other.tree.Height < tree.Height || tree.Height == 0:
+			c.remove(element)
+		case entry.until == 0 || other.tree.Height < entry.until:
+			entry.until = other.tree.Height
+		}
+	}
+	if c.roots[key.id] == nil {
+		c.roots[key.id] = map[string]*list.Element{}
+	}
+	c.roots[key.id][key.root] = c.lru.PushFront(entry)
+	c.leaves += len(entry.tree.Leaves)
+
+	// Keep the tree just fetched even when it alone exceeds the limits
+	for c.lru.Len() > 1 && (c.lru.Len() > c.maxTrees || c.leaves > c.maxLeaves) {
+		c.remove(c.lru.Back())
+	}
+}
+
+func (c *treeCache) remove(element *list.Element) {
+	entry := c.lru.Remove(element).(*cachedTree)
+	delete(c.roots[entry.key.id], entry.key.root)
+	if len(c.roots[entry.key.id]) == 0 {
+		delete(c.roots, entry.key.id)
+	}
+	c.leaves -= len(entry.tree.Leaves)
+}
+
+// invalidate drops every root of the given trees, or every tree when no id is
+// given
+func (c *treeCache) invalidate(ids ...string) {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+
+	if len(ids) == 0 {
+		c.roots = map[string]map[string]*list.Element{}
+		c.lru.Init()
+		c.leaves = 0
+		return
+	}
+	for _, id := range ids {
+		for _, element := range c.roots[id] {
+			c.remove(element)
+		}
+	}
+}
+
+// copyTree returns a copy of a cached tree. The leaves are shared and must
+// not be modified.
+func copyTree(tree *MerkleTree) *MerkleTree {
+	copied := *tree
+	return &copied
+}
+
+// pinnedHeight returns the block height set by AtHeight on ctx, 0 when none
+func pinnedHeight(ctx context.Context) int64 {
+	md, _ := metadata.FromOutgoingContext(ctx)
+	return headerHeight(md)
+}
+
+// InvalidateTrees drops the given trees from the tree cache, or every tree
+// when no id is given, so they are fetched again on their next use
+func (cqc *CosmosQueryClient) InvalidateTrees(ids ...string) {
+	if cqc.cache != nil {
+		cqc.cache.invalidate(ids...)
+	}
+}
@@ -0,0 +1,347 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"sync"
+	"sync/atomic"
+	"testing"
+	"time"
+)
+
+// treeFetcher counts fetches and returns trees read at the pinned height
+type treeFetcher struct {
+	calls     atomic.Int32
+	leaves    int
+	release   chan struct{} // Blocks fetches until closed when not nil
+	changedAt int64         // Height the trees change root at, 0 for never
+}
+
+func (f *treeFetcher) fetch(id string) func(ctx context.Context) (*MerkleTree, error) {
+	return func(ctx context.Context) (*MerkleTree, error) {
+		f.calls.Add(1)
+		if f.release != nil {
+			<-f.release
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		height := pinnedHeight(ctx)
+		root := "root-" + id
+		if f.changedAt > 0 && height >= f.changedAt {
+			root = "new-root-" + id
+		}
+		return &MerkleTree{
+			ID:     id,
+			Root:   root,
+			Leaves: make([]string, f.leaves),
+			Height: height,
+		}, nil
+	}
+}
+
+func testCache(ttl time.Duration, maxTrees, maxLeaves int) (*treeCache, *time.Time) {
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	cache := newTreeCache(ttl, maxTrees, maxLeaves)
+	cache.now = func() time.Time { return now }
+	return cache, &now
+}
+
+// waitFetching waits until fetcher has been called calls times
+func waitFetching(fetcher *treeFetcher, calls int32) {
+	for fetcher.calls.Load() < calls {
+		time.Sleep(time.Millisecond)
+	}
+}
+
+func TestTreeCacheSingleFlight(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 1000)
+	fetcher := &treeFetcher{release: make(chan struct{})}
+	ctx := AtHeight(context.Background(), 100)
+
+	const workers = 8
+	var wg sync.WaitGroup
+	trees := make([]*MerkleTree, workers)
+	get := func(i int) {
+		defer wg.Done()
+		tree, err := cache.get(ctx, "a", fetcher.fetch("a"))
+		if err != nil {
+			t.Errorf("get: %v", err)
+			return
+		}
+		trees[i] = tree
+	}
+
+	// The other workers start while the first fetch is blocked
+	wg.Add(workers)
+	go get(0)
+	waitFetching(fetcher, 1)
+	for i := 1; i < workers; i++ {
+		go get(i)
+	}
+	time.Sleep(50 * time.Millisecond)
+	close(fetcher.release)
+	wg.Wait()
+
+	if calls := fetcher.calls.Load(); calls != 1 {
+		t.Errorf("tree fetched %d times, want 1", calls)
+	}
+	for i, tree := range trees {
+		if tree == nil || tree.Root != "root-a" {
+			t.Errorf("worker %d got %+v", i, tree)
+		}
+	}
+
+	// Each caller gets its own copy
+	trees[0].Root = "modified"
+	if tree, _ := cache.get(ctx, "a", fetcher.fetch("a")); tree.Root != "root-a" {
+		t.Errorf("cached tree modified through a returned copy: %+v", tree)
+	}
+}
+
+func TestTreeCacheCancelledCaller(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 1000)
+	fetcher := &treeFetcher{release: make(chan struct{})}
+	pinned := AtHeight(context.Background(), 100)
+
+	// The caller whose fetch is shared gives up while it is running
+	ctx, cancel := context.WithCancel(pinned)
+	firstErr := make(chan error, 1)
+	go func() {
+		_, err := cache.get(ctx, "a", fetcher.fetch("a"))
+		firstErr <- err
+	}()
+	waitFetching(fetcher, 1)
+
+	waiter := make(chan *MerkleTree, 1)
+	go func() {
+		tree, err := cache.get(pinned, "a", fetcher.fetch("a"))
+		if err != nil {
+			t.Errorf("waiting caller failed: %v", err)
+		}
+		waiter <- tree
+	}()
+	time.Sleep(20 * time.Millisecond)
+	cancel()
+	if err := <-firstErr; err != context.Canceled {
+		t.Errorf("cancelled caller got %v, want %v", err, context.Canceled)
+	}
+
+	close(fetcher.release)
+	if tree := <-waiter; tree == nil || tree.Root != "root-a" {
+		t.Errorf("waiting caller got %+v", tree)
+	}
+	if calls := fetcher.calls.Load(); calls != 1 {
+		t.Errorf("tree fetched %d times, want 1", calls)
+	}
+}
+
+func TestTreeCacheSharesRootAcrossHeights(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 1000)
+	fetcher := &treeFetcher{}
+
+	// An unchanged tree is fetched once for every later height
+	for _, height := range []int64{100, 100, 101, 150} {
+		tree, err := cache.get(AtHeight(context.Background(), height), "a", fetcher.fetch("a"))
+		if err != nil {
+			t.Fatalf("get at %d: %v", height, err)
+		}
+		if tree.Root != "root-a" || tree.Height != 100 {
+			t.Errorf("get at %d returned %s read at %d, want root-a read at 100", height, tree.Root, tree.Height)
+		}
+	}
+	if calls := fetcher.calls.Load(); calls != 1 {
+		t.Errorf("tree fetched %d times, want 1", calls)
+	}
+
+	// A tree read at 100 may not exist yet at an earlier height
+	if tree, _ := cache.get(AtHeight(context.Background(), 99), "a", fetcher.fetch("a")); tree.Height != 99 {
+		t.Errorf("get at 99 returned a tree read at %d", tree.Height)
+	}
+	if calls := fetcher.calls.Load(); calls != 2 {
+		t.Errorf("tree fetched %d times, want 2", calls)
+	}
+	if !cache.cached("a", "root-a") || len(cache.keys()) != 1 {
+		t.Errorf("cached trees = %v, want root-a only", cache.keys())
+	}
+}
+
+func TestTreeCacheRootChange(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 1000)
+	fetcher := &treeFetcher{changedAt: 110}
+	get := func(height int64) *MerkleTree {
+		t.Helper()
+		tree, err := cache.get(AtHeight(context.Background(), height), "a", fetcher.fetch("a"))
+		if err != nil {
+			t.Fatalf("get at %d: %v", height, err)
+		}
+		return tree
+	}
+
+	// A contract event drops the tree, the next read sees the new root
+	get(100)
+	cache.invalidate("a")
+	if tree := get(112); tree.Root != "new-root-a" {
+		t.Fatalf("get at 112 = %s, want new-root-a", tree.Root)
+	}
+
+	// A worker still pinned before the change reads the old root, which only
+	// serves the heights before the new root was read
+	if tree := get(105); tree.Root != "root-a" {
+		t.Errorf("get at 105 = %s, want root-a", tree.Root)
+	}
+	calls := fetcher.calls.Load()
+	for height, want := range map[int64]string{107: "root-a", 112: "new-root-a", 120: "new-root-a", 0: "new-root-a"} {
+		if tree := get(height); tree.Root != want {
+			t.Errorf("get at %d = %s, want %s", height, tree.Root, want)
+		}
+	}
+	if fetcher.calls.Load() != calls {
+		t.Errorf("tree fetched %d more times, want 0", fetcher.calls.Load()-calls)
+	}
+
+	// Reading the new root again later supersedes the older roots
+	cache.store(&MerkleTree{ID: "a", Root: "new-root-a", Height: 130})
+	if cache.cached("a", "root-a") || !cache.cached("a", "new-root-a") {
+		t.Errorf("cached trees = %v, want new-root-a only", cache.keys())
+	}
+	if tree := get(120); tree.Height != 112 {
+		t.Errorf("new-root-a read at %d, want 112 when first read", tree.Height)
+	}
+}
+
+func TestTreeCacheEvictedNewerRoot(t *testing.T) {
+	cache, _ := testCache(time.Minute, 1, 1000)
+	fetcher := &treeFetcher{changedAt: 110}
+	ctx := func(height int64) context.Context { return AtHeight(context.Background(), height) }
+
+	cache.get(ctx(110), "a", fetcher.fetch("a"))
+	// Reading the old root evicts the newer one from the single slot
+	cache.get(ctx(105), "a", fetcher.fetch("a"))
+	if !cache.cached("a", "root-a") || cache.cached("a", "new-root-a") {
+		t.Fatalf("cached trees = %v, want root-a only", cache.keys())
+	}
+
+	// The old root is known to be replaced at 110
+	if tree, _ := cache.get(ctx(115), "a", fetcher.fetch("a")); tree.Root != "new-root-a" {
+		t.Errorf("get at 115 = %s, want new-root-a", tree.Root)
+	}
+	if calls := fetcher.calls.Load(); calls != 3 {
+		t.Errorf("tree fetched %d times, want 3", calls)
+	}
+}
+
+func TestTreeCacheRejectsOtherHeight(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 1000)
+	calls := 0
+	fetch := func(ctx context.Context) (*MerkleTree, error) {
+		calls++
+		return &MerkleTree{ID: "a", Root: "root", Height: 99}, nil
+	}
+
+	ctx := AtHeight(context.Background(), 100)
+	if tree, err := cache.get(ctx, "a", fetch); err == nil {
+		t.Fatalf("get returned a tree read at %d for height 100", tree.Height)
+	}
+	if _, err := cache.get(ctx, "a", fetch); err == nil || calls != 2 {
+		t.Errorf("tree read at another height was cached (calls %d, error %v)", calls, err)
+	}
+}
+
+func TestTreeCacheTTL(t *testing.T) {
+	cache, now := testCache(time.Minute, 10, 1000)
+	fetcher := &treeFetcher{}
+	ctx := AtHeight(context.Background(), 100)
+
+	cache.get(ctx, "a", fetcher.fetch("a"))
+	*now = now.Add(time.Minute)
+	cache.get(ctx, "a", fetcher.fetch("a"))
+	if calls := fetcher.calls.Load(); calls != 1 {
+		t.Fatalf("tree fetched %d times within the ttl, want 1", calls)
+	}
+
+	*now = now.Add(time.Second)
+	cache.get(ctx, "a", fetcher.fetch("a"))
+	if calls := fetcher.calls.Load(); calls != 2 {
+		t.Errorf("tree fetched %d times after the ttl, want 2", calls)
+	}
+	if len(cache.keys()) != 1 || cache.leaves != 0 {
+		t.Errorf("expired entry kept: %v", cache.keys())
+	}
+}
+
+func TestTreeCacheLRU(t *testing.T) {
+	cache, _ := testCache(time.Minute, 2, 1000)
+	fetcher := &treeFetcher{}
+	ctx := AtHeight(context.Background(), 100)
+
+	cache.get(ctx, "a", fetcher.fetch("a"))
+	cache.get(ctx, "b", fetcher.fetch("b"))
+	cache.get(ctx, "a", fetcher.fetch("a")) // b is now the least recently used
+	cache.get(ctx, "c", fetcher.fetch("c"))
+
+	if !cache.cached("a", "root-a") || cache.cached("b", "root-b") || !cache.cached("c", "root-c") {
+		t.Errorf("cached trees = %v, want a and c", cache.keys())
+	}
+}
+
+func TestTreeCacheMaxLeaves(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 25)
+	fetcher := &treeFetcher{leaves: 10}
+	ctx := AtHeight(context.Background(), 100)
+
+	cache.get(ctx, "a", fetcher.fetch("a"))
+	cache.get(ctx, "b", fetcher.fetch("b"))
+	if cache.leaves != 20 {
+		t.Fatalf("leaves = %d, want 20", cache.leaves)
+	}
+	cache.get(ctx, "c", fetcher.fetch("c"))
+	if cache.cached("a", "root-a") || cache.leaves != 20 {
+		t.Errorf("cached trees = %v with %d leaves, want b and c with 20", cache.keys(), cache.leaves)
+	}
+
+	// A tree larger than the cap alone is still kept until the next store
+	fetcher.leaves = 100
+	cache.get(ctx, "d", fetcher.fetch("d"))
+	if len(cache.keys()) != 1 || !cache.cached("d", "root-d") {
+		t.Errorf("cached trees = %v, want only d", cache.keys())
+	}
+}
+
+func TestTreeCacheInvalidate(t *testing.T) {
+	cache, _ := testCache(time.Minute, 10, 1000)
+	fetcher := &treeFetcher{leaves: 1, changedAt: 101}
+
+	for _, height := range []int64{101, 100} {
+		ctx := AtHeight(context.Background(), height)
+		cache.get(ctx, "a", fetcher.fetch("a"))
+		cache.get(ctx, "b", fetcher.fetch("b"))
+	}
+
+	cache.invalidate("a")
+	if cache.cached("a", "root-a") || cache.cached("a", "new-root-a") || !cache.cached("b", "new-root-b") || cache.leaves != 2 {
+		t.Errorf("cached trees = %v with %d leaves after invalidating a", cache.keys(), cache.leaves)
+	}
+	cache.invalidate()
+	if len(cache.roots) != 0 || cache.lru.Len() != 0 || cache.leaves != 0 {
+		t.Errorf("cached trees = %v after invalidating every tree", cache.keys())
+	}
+}
+
+func (c *treeCache) cached(id, root string) bool {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	_, ok := c.roots[id][root]
+	return ok
+}
+
+func (c *treeCache) keys() []string {
+	c.mu.Lock()
+	defer c.mu.Unlock()
+	var keys []string
+	for element := c.lru.Front(); element != nil; element = element.Next() {
+		entry := element.Value.(*cachedTree)
+		keys = append(keys, fmt.Sprintf("%s/%s@%d", entry.key.id, entry.key.root, entry.tree.Height))
+	}
+	return keys
+}
@@ -0,0 +1,101 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"iter"
+	"regexp"
+)
+
+// TreeFilter selects the trees to work on
+type TreeFilter func(tree *MerkleTree) bool
+
+// MetadataMatches selects the trees whose metadata matches pattern
+func MetadataMatches(pattern *regexp.Regexp) TreeFilter {
+	return func(tree *MerkleTree) bool {
+		return pattern.MatchString(tree.Metadata)
+	}
+}
+
+// MerkleTreeIds streams every tree id. With TreePageSize set the ids are
+// fetched one page at a time, so only one page is held in memory and a
+// consumer that stops early saves the remaining queries. A failed query is
+// yielded as an error and ends the iteration.
+func (cqc *CosmosQueryClient) MerkleTreeIds(ctx context.Context) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		for page, err := range cqc.MerkleTreeIdPages(ctx) {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			for _, treeId := range page {
+				if !yield(treeId, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// MerkleTreeIdPages streams the tree ids one page of TreePageSize ids at a
+// time, or all of them in a single page when paging is disabled. A failed
+// query is yielded as an error and ends the iteration.
+func (cqc *CosmosQueryClient) MerkleTreeIdPages(ctx context.Context) iter.Seq2[[]string, error] {
+	return func(yield func([]string, error) bool) {
+		limit := cqc.config.TreePageSize
+		startAfter := ""
+		for {
+			page, err := cqc.ListMerkleTreeIdsPage(ctx, startAfter, limit)
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+			// Contracts cap the limit they are sent, so a page shorter than
+			// the limit is not necessarily the last one: only an empty page
+			// ends the listing
+			if limit > 0 && len(page) == 0 {
+				return
+			}
+			if !yield(page, nil) || limit == 0 {
+				return
+			}
+
+			// Guard against a contract that ignores start_after and would
+			// return the same page forever
+			last := page[len(page)-1]
+			if last == startAfter {
+				yield(nil, fmt.Errorf("contract returned the page after %q again, it does not support pagination", startAfter))
+				return
+			}
+			startAfter = last
+		}
+	}
+}
+
+// MerkleTrees streams the trees selected by filter, or every tree when
+// filter is nil. A tree that cannot be fetched is yielded as an error and the
+// iteration goes on with the next one.
+func (cqc *CosmosQueryClient) MerkleTrees(ctx context.Context, filter TreeFilter) iter.Seq2[*MerkleTree, error] {
+	return func(yield func(*MerkleTree, error) bool) {
+		for treeId, err := range cqc.MerkleTreeIds(ctx) {
+			if err != nil {
+				yield(nil, err)
+				return
+			}
+
+			tree, err := cqc.GetMerkleTreeData(ctx, treeId)
+			if err != nil {
+				if !yield(nil, fmt.Errorf("tree %s: %v", treeId, err)) {
+					return
+				}
+				continue
+			}
+			if filter != nil && !filter(tree) {
+				continue
+			}
+			if !yield(tree, nil) {
+				return
+			}
+		}
+	}
+}
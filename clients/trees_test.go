@@ -0,0 +1,54 @@
+package clients
+
+import (
+	"context"
+	"fmt"
+	"slices"
+	"testing"
+)
+
+func TestMerkleTreeIdPages(t *testing.T) {
+	trees := map[string]MerkleTree{}
+	var want []string
+	for i := range 25 {
+		treeId := fmt.Sprintf("tree-%02d", i)
+		trees[treeId] = MerkleTree{Root: "root"}
+		want = append(want, treeId)
+	}
+
+	tests := []struct {
+		name      string
+		pageSize  uint32
+		idLimit   int // Limit cap of the contract
+		wantPages []int
+	}{
+		{"unpaged", 0, 0, []int{25}},
+		{"pages", 10, 0, []int{10, 10, 5}},
+		{"exact pages", 5, 0, []int{5, 5, 5, 5, 5}},
+		{"limit capped by the contract", 30, 10, []int{10, 10, 5}},
+		{"limit not capped", 30, 100, []int{25}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			node := &fakeNode{height: 100, trees: trees, idLimit: tt.idLimit}
+			cqc := newFakeClient(t, node)
+			cqc.config.TreePageSize = tt.pageSize
+
+			var ids []string
+			var pages []int
+			for page, err := range cqc.MerkleTreeIdPages(context.Background()) {
+				if err != nil {
+					t.Fatalf("MerkleTreeIdPages: %v", err)
+				}
+				ids = append(ids, page...)
+				pages = append(pages, len(page))
+			}
+			if !slices.Equal(ids, want) {
+				t.Errorf("ids = %v, want %v", ids, want)
+			}
+			if !slices.Equal(pages, tt.wantPages) {
+				t.Errorf("page sizes = %v, want %v", pages, tt.wantPages)
+			}
+		})
+	}
+}
@@ -0,0 +1,399 @@
+package config
+
+import (
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"math"
+	"net/url"
+	"os"
+	"regexp"
+	"strings"
+	"time"
+)
+
+// Duration is a time.Duration written as a string such as "5s" or "1m30s" in
+// configuration files
+type Duration time.Duration
+
+func (d Duration) Duration() time.Duration {
+	return time.Duration(d)
+}
+
+func (d Duration) String() string {
+	return time.Duration(d).String()
+}
+
+func (d Duration) MarshalText() ([]byte, error) {
+	return []byte(d.String()), nil
+}
+
+func (d *Duration) UnmarshalText(text []byte) error {
+	parsed, err := time.ParseDuration(strings.TrimSpace(string(text)))
+	if err != nil {
+		return fmt.Errorf("invalid duration %q", text)
+	}
+	*d = Duration(parsed)
+	return nil
+}
+
+// GRPCConfig selects the chain endpoints and the Merkle tree contract
+type GRPCConfig struct {
+	URLs                []string          `yaml:"urls" toml:"urls"` // Queried in order of health and latency, failing over on errors
+	ContractAddr        string            `yaml:"contract_addr" toml:"contract_addr"`
+	HealthCheckInterval Duration          `yaml:"health_check_interval" toml:"health_check_interval"` // Probe every endpoint this often, 0 disables the probes
+	KeepaliveTime       Duration          `yaml:"keepalive_time" toml:"keepalive_time"`               // Ping interval of an idle connection, 0 disables keepalive
+	KeepaliveTimeout    Duration          `yaml:"keepalive_timeout" toml:"keepalive_timeout"`         // Time to wait for a ping answer before reconnecting
+	TLS                 TLSConfig         `yaml:"tls" toml:"tls"`
+	Metadata            map[string]string `yaml:"metadata" toml:"metadata"` // Sent with every RPC, e.g. an API key header
+}
+
+// TLSConfig selects the transport security of the gRPC connection. When
+// enabled without a CA bundle, the server is verified against the system
+// roots. A client certificate and key enable mutual TLS.
+type TLSConfig struct {
+	Enabled    bool   `yaml:"enabled" toml:"enabled"`
+	CAFile     string `yaml:"ca_file" toml:"ca_file"`
+	CertFile   string `yaml:"cert_file" toml:"cert_file"`
+	KeyFile    string `yaml:"key_file" toml:"key_file"`
+	ServerName string `yaml:"server_name" toml:"server_name"` // Overrides the name checked against the server certificate
+}
+
+// TreesConfig controls how trees are listed and which ones are sampled
+type TreesConfig struct {
+	PageSize       int      `yaml:"page_size" toml:"page_size"`               // Tree ids fetched per query, 0 fetches them all at once
+	MetadataFilter string   `yaml:"metadata_filter" toml:"metadata_filter"`   // Regular expression the tree metadata must match, empty samples every tree
+	SkipTags       []string `yaml:"skip_tags" toml:"skip_tags"`               // Skip the trees whose JSON metadata carries one of these tags
+	Owners         []string `yaml:"owners" toml:"owners"`                     // Only sample the trees whose JSON metadata names one of these owners
+	PreferTags     []string `yaml:"prefer_tags" toml:"prefer_tags"`           // Work first on the trees carrying these tags, in this order
+	Order          string   `yaml:"order" toml:"order"`                       // newest or oldest created_height first, empty keeps the contract order
+	CacheTTL       Duration `yaml:"cache_ttl" toml:"cache_ttl"`               // Share fetched trees between workers this long, 0 disables the cache
+	CacheSize      int      `yaml:"cache_size" toml:"cache_size"`             // Maximum number of cached trees
+	CacheMaxLeaves int      `yaml:"cache_max_leaves" toml:"cache_max_leaves"` // Maximum number of leaves of all cached trees
+}
+
+// EventsConfig enables the contract event subscription, which replaces the
+// fixed pace polling of the workers while it is live
+type EventsConfig struct {
+	RPCURL       string   `yaml:"rpc_url" toml:"rpc_url"`             // CometBFT RPC address, empty disables the subscription
+	PollInterval Duration `yaml:"poll_interval" toml:"poll_interval"` // Pause between two polls while the subscription is live
+}
+
+// ProofConfig enables the verification of the trees with ICS23 proofs of the
+// contract storage, checked against headers verified by a CometBFT light
+// client started from a header trusted out of band
+type ProofConfig struct {
+	Enabled        bool     `yaml:"enabled" toml:"enabled"`
+	ChainID        string   `yaml:"chain_id" toml:"chain_id"`
+	RPCURL         string   `yaml:"rpc_url" toml:"rpc_url"`                 // Primary CometBFT RPC of the light client
+	Witnesses      []string `yaml:"witnesses" toml:"witnesses"`             // CometBFT RPCs cross-checking the primary
+	TrustedHeight  int64    `yaml:"trusted_height" toml:"trusted_height"`   // Height of the trusted header
+	TrustedHash    string   `yaml:"trusted_hash" toml:"trusted_hash"`       // Hex hash of the trusted header
+	TrustingPeriod Duration `yaml:"trusting_period" toml:"trusting_period"` // Must be shorter than the unbonding period of the chain
+	TreeNamespace  string   `yaml:"tree_namespace" toml:"tree_namespace"`   // Storage namespace of the tree map of the contract
+}
+
+// ProverConfig selects the prover backend. The http backend uses URLs in
+// priority order.
+type ProverConfig struct {
+	Backend string   `yaml:"backend" toml:"backend"`
+	URLs    []string `yaml:"urls" toml:"urls"`
+}
+
+// PointsConfig points to the API receiving verified proofs
+type PointsConfig struct {
+	URL string `yaml:"url" toml:"url"`
+}
+
+// WorkerConfig controls the pace of the workers
+type WorkerConfig struct {
+	Interval     Duration `yaml:"interval" toml:"interval"`           // Pause between two runs of a worker
+	StartStagger Duration `yaml:"start_stagger" toml:"start_stagger"` // Delay between starting two workers
+}
+
+// SleepConfig controls how long a tree with an unchanged root sleeps
+type SleepConfig struct {
+	Policy        string   `yaml:"policy" toml:"policy"` // fixed or exponential
+	Threshold     int      `yaml:"threshold" toml:"threshold"`
+	Duration      Duration `yaml:"duration" toml:"duration"`
+	BackoffFactor float64  `yaml:"backoff_factor" toml:"backoff_factor"`
+	MaxDuration   Duration `yaml:"max_duration" toml:"max_duration"`
+}
+
+// FilesConfig holds the paths of the files kept by the node. An empty path
+// keeps the data in memory only.
+type FilesConfig struct {
+	TreeState string `yaml:"tree_state" toml:"tree_state"`
+	Ledger    string `yaml:"ledger" toml:"ledger"`
+	Outbox    string `yaml:"outbox" toml:"outbox"`
+}
+
+// LogConfig selects the log level (debug, info, warn or error) and format
+// (text or json)
+type LogConfig struct {
+	Level  string `yaml:"level" toml:"level"`
+	Format string `yaml:"format" toml:"format"`
+}
+
+// Config is the complete configuration of the light node
+type Config struct {
+	GRPC           GRPCConfig   `yaml:"grpc" toml:"grpc"`
+	Trees          TreesConfig  `yaml:"trees" toml:"trees"`
+	Events         EventsConfig `yaml:"events" toml:"events"`
+	Proof          ProofConfig  `yaml:"proof" toml:"proof"`
+	Prover         ProverConfig `yaml:"prover" toml:"prover"`
+	Points         PointsConfig `yaml:"points" toml:"points"`
+	RequestTimeout Duration     `yaml:"request_timeout" toml:"request_timeout"` // Timeout of prover and points API requests
+	PrivateKey     string       `yaml:"private_key" toml:"private_key"`         // Used when wallet.txt is missing or empty
+	Worker         WorkerConfig `yaml:"worker" toml:"worker"`
+	Sleep          SleepConfig  `yaml:"sleep" toml:"sleep"`
+	Files          FilesConfig  `yaml:"files" toml:"files"`
+	MetricsAddr    string       `yaml:"metrics_addr" toml:"metrics_addr"` // Empty disables the metrics server
+	StatusAddr     string       `yaml:"status_addr" toml:"status_addr"`   // Empty disables the status API
+	Log            LogConfig    `yaml:"log" toml:"log"`
+	Watch          bool         `yaml:"watch" toml:"watch"` // Hot reload selected settings when the files change
+}
+
+// Default returns the configuration used when nothing is overridden
+func Default() *Config {
+	return &Config{
+		GRPC: GRPCConfig{
+			URLs:                []string{"grpc.testnet.layeredge.io:9090"},
+			HealthCheckInterval: Duration(30 * time.Second),
+			ContractAddr:        "cosmos1ufs3tlq4umljk0qfe8k5ya0x6hpavn897u2cnf9k0en9jr7qarqqt56709",
+			KeepaliveTime:       Duration(30 * time.Second),
+			KeepaliveTimeout:    Duration(10 * time.Second),
+		},
+		Trees: TreesConfig{
+			CacheTTL:       Duration(30 * time.Second),
+			CacheSize:      256,
+			CacheMaxLeaves: 1000000,
+		},
+		Events: EventsConfig{
+			PollInterval: Duration(time.Minute),
+		},
+		Proof: ProofConfig{
+			TrustingPeriod: Duration(168 * time.Hour),
+			TreeNamespace:  "trees",
+		},
+		Prover: ProverConfig{
+			Backend: "http",
+			URLs:    []string{"http://127.0.0.1:3001"},
+		},
+		Points: PointsConfig{
+			URL: "http://127.0.0.1:3001",
+		},
+		RequestTimeout: Duration(100 * time.Second),
+		Worker: WorkerConfig{
+			Interval:     Duration(5 * time.Second),
+			StartStagger: Duration(500 * time.Millisecond),
+		},
+		Sleep: SleepConfig{
+			Policy:        "fixed",
+			Threshold:     3,
+			Duration:      Duration(5 * time.Minute),
+			BackoffFactor: 2,
+			MaxDuration:   Duration(time.Hour),
+		},
+		Files: FilesConfig{
+			TreeState: "tree_states.json",
+			Ledger:    "submissions.jsonl",
+			Outbox:    "outbox.json",
+		},
+		StatusAddr: "127.0.0.1:8085",
+		Log: LogConfig{
+			Level:  "info",
+			Format: "text",
+		},
+	}
+}
+
+// Validate checks every setting and reports all invalid ones at once
+func (c *Config) Validate() error {
+	var errs []error
+	invalid := func(format string, args ...interface{}) {
+		errs = append(errs, fmt.Errorf(format, args...))
+	}
+
+	if len(c.GRPC.URLs) == 0 {
+		invalid("grpc.urls (GRPC_URL) must contain at least one endpoint")
+	}
+	if c.GRPC.HealthCheckInterval < 0 {
+		invalid("grpc.health_check_interval (GRPC_HEALTH_CHECK_INTERVAL) must not be negative")
+	}
+	if c.GRPC.ContractAddr == "" {
+		invalid("grpc.contract_addr (CONTRACT_ADDR) must be set")
+	}
+	if c.GRPC.KeepaliveTime < 0 {
+		invalid("grpc.keepalive_time (GRPC_KEEPALIVE_TIME) must not be negative")
+	}
+	if c.GRPC.KeepaliveTime > 0 && c.GRPC.KeepaliveTimeout <= 0 {
+		invalid("grpc.keepalive_timeout (GRPC_KEEPALIVE_TIMEOUT) must be a positive duration when keepalive is enabled")
+	}
+	if tlsConfig := c.GRPC.TLS; !tlsConfig.Enabled {
+		if tlsConfig.CAFile != "" || tlsConfig.CertFile != "" || tlsConfig.KeyFile != "" {
+			invalid("grpc.tls.enabled (GRPC_TLS) must be true when a CA bundle or client certificate is set")
+		}
+	} else {
+		if (tlsConfig.CertFile == "") != (tlsConfig.KeyFile == "") {
+			invalid("grpc.tls.cert_file (GRPC_TLS_CERT_FILE) and grpc.tls.key_file (GRPC_TLS_KEY_FILE) must be set together")
+		}
+		for _, file := range []struct{ name, path string }{
+			{"grpc.tls.ca_file (GRPC_TLS_CA_FILE)", tlsConfig.CAFile},
+			{"grpc.tls.cert_file (GRPC_TLS_CERT_FILE)", tlsConfig.CertFile},
+			{"grpc.tls.key_file (GRPC_TLS_KEY_FILE)", tlsConfig.KeyFile},
+		} {
+			if file.path == "" {
+				continue
+			}
+			if _, err := os.Stat(file.path); err != nil {
+				invalid("%s: %v", file.name, err)
+			}
+		}
+	}
+	for key := range c.GRPC.Metadata {
+		if key == "" || key != strings.ToLower(key) {
+			invalid("grpc.metadata (GRPC_METADATA) keys must be lowercase, got %q", key)
+		}
+	}
+
+	if c.Trees.PageSize < 0 || int64(c.Trees.PageSize) > math.MaxUint32 {
+		invalid("trees.page_size (TREE_PAGE_SIZE) must be between 0 and %d", uint32(math.MaxUint32))
+	}
+	if _, err := regexp.Compile(c.Trees.MetadataFilter); err != nil {
+		invalid("trees.metadata_filter (TREE_METADATA_FILTER): %v", err)
+	}
+	switch c.Trees.Order {
+	case "", "newest", "oldest":
+	default:
+		invalid("trees.order (TREE_ORDER) must be newest, oldest or empty, got %q", c.Trees.Order)
+	}
+
+	if c.Trees.CacheTTL < 0 {
+		invalid("trees.cache_ttl (TREE_CACHE_TTL) must not be negative")
+	}
+	// Ordering fetches the trees of a page to sort them, the worker then
+	// reads them back from the cache
+	if c.Trees.CacheTTL == 0 && (len(c.Trees.PreferTags) > 0 || c.Trees.Order != "") {
+		invalid("trees.cache_ttl (TREE_CACHE_TTL) must be positive when trees.prefer_tags (TREE_PREFER_TAGS) or trees.order (TREE_ORDER) is set")
+	}
+	if c.Trees.CacheTTL > 0 {
+		if c.Trees.CacheSize < 1 {
+			invalid("trees.cache_size (TREE_CACHE_SIZE) must be a positive integer when the cache is enabled")
+		}
+		if c.Trees.CacheMaxLeaves < 1 {
+			invalid("trees.cache_max_leaves (TREE_CACHE_MAX_LEAVES) must be a positive integer when the cache is enabled")
+		}
+	}
+
+	if c.Events.RPCURL != "" {
+		if u, err := url.Parse(c.Events.RPCURL); err != nil || u.Host == "" ||
+			(u.Scheme != "http" && u.Scheme != "https" && u.Scheme != "tcp" && u.Scheme != "ws" && u.Scheme != "wss") {
+			invalid("events.rpc_url (EVENTS_RPC_URL) must be an http(s), tcp or ws(s) URL, got %q", c.Events.RPCURL)
+		}
+	}
+	if c.Events.PollInterval <= 0 {
+		invalid("events.poll_interval (EVENTS_POLL_INTERVAL) must be a positive duration")
+	}
+
+	if c.Proof.Enabled {
+		if c.Proof.ChainID == "" {
+			invalid("proof.chain_id (PROOF_CHAIN_ID) must be set when proofs are verified")
+		}
+		if err := checkHTTPURL(c.Proof.RPCURL); err != nil {
+			invalid("proof.rpc_url (PROOF_RPC_URL): %v", err)
+		}
+		if len(c.Proof.Witnesses) == 0 {
+			invalid("proof.witnesses (PROOF_WITNESSES) must contain at least one RPC URL when proofs are verified")
+		}
+		for _, witness := range c.Proof.Witnesses {
+			if err := checkHTTPURL(witness); err != nil {
+				invalid("proof.witnesses (PROOF_WITNESSES): %v", err)
+			}
+		}
+		if c.Proof.TrustedHeight <= 0 {
+			invalid("proof.trusted_height (PROOF_TRUSTED_HEIGHT) must be a positive height")
+		}
+		if hash, err := hex.DecodeString(c.Proof.TrustedHash); err != nil || len(hash) != 32 {
+			invalid("proof.trusted_hash (PROOF_TRUSTED_HASH) must be a 32 byte hex hash")
+		}
+		if c.Proof.TrustingPeriod <= 0 {
+			invalid("proof.trusting_period (PROOF_TRUSTING_PERIOD) must be a positive duration")
+		}
+		if c.Proof.TreeNamespace == "" || len(c.Proof.TreeNamespace) > math.MaxUint16 {
+			invalid("proof.tree_namespace (PROOF_TREE_NAMESPACE) must be set")
+		}
+	}
+
+	switch c.Prover.Backend {
+	case "http":
+		if len(c.Prover.URLs) == 0 {
+			invalid("prover.urls (ZK_PROVER_URL) must contain at least one URL with the http backend")
+		}
+		for _, proverURL := range c.Prover.URLs {
+			if err := checkHTTPURL(proverURL); err != nil {
+				invalid("prover.urls (ZK_PROVER_URL): %v", err)
+			}
+		}
+	case "merkle":
+	default:
+		invalid("prover.backend (PROVER_BACKEND) must be http or merkle, got %q", c.Prover.Backend)
+	}
+
+	if err := checkHTTPURL(c.Points.URL); err != nil {
+		invalid("points.url (POINTS_API): %v", err)
+	}
+	if c.RequestTimeout.Duration() < time.Second {
+		invalid("request_timeout (API_REQUEST_TIMEOUT) must be at least 1s")
+	}
+
+	if c.Worker.Interval <= 0 {
+		invalid("worker.interval (WORKER_INTERVAL) must be a positive duration")
+	}
+	if c.Worker.StartStagger < 0 {
+		invalid("worker.start_stagger (WORKER_START_STAGGER) must not be negative")
+	}
+
+	if c.Sleep.Threshold < 1 {
+		invalid("sleep.threshold (SLEEP_THRESHOLD) must be a positive integer")
+	}
+	if c.Sleep.Duration <= 0 {
+		invalid("sleep.duration (SLEEP_DURATION) must be a positive duration such as 5m")
+	}
+	switch c.Sleep.Policy {
+	case "fixed":
+	case "exponential":
+		if c.Sleep.BackoffFactor < 1 {
+			invalid("sleep.backoff_factor (SLEEP_BACKOFF_FACTOR) must be a number >= 1")
+		}
+		if c.Sleep.MaxDuration < c.Sleep.Duration {
+			invalid("sleep.max_duration (SLEEP_MAX_DURATION) must be a duration >= sleep.duration")
+		}
+	default:
+		invalid("sleep.policy (SLEEP_POLICY) must be fixed or exponential, got %q", c.Sleep.Policy)
+	}
+
+	switch strings.ToLower(c.Log.Level) {
+	case "debug", "info", "warn", "error":
+	default:
+		invalid("log.level (LOG_LEVEL) must be debug, info, warn or error, got %q", c.Log.Level)
+	}
+	switch strings.ToLower(c.Log.Format) {
+	case "text", "json":
+	default:
+		invalid("log.format (LOG_FORMAT) must be text or json, got %q", c.Log.Format)
+	}
+
+	if len(errs) > 0 {
+		return fmt.Errorf("invalid configuration:\n%w", errors.Join(errs...))
+	}
+	return nil
+}
+
+func checkHTTPURL(value string) error {
+	u, err := url.Parse(value)
+	if err != nil || (u.Scheme != "http" && u.Scheme != "https") || u.Host == "" {
+		return fmt.Errorf("%q is not an http(s) URL", value)
+	}
+	return nil
+}
@@ -0,0 +1,277 @@
+package config
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestValidate(t *testing.T) {
+	tests := []struct {
+		name    string
+		change  func(c *Config)
+		wantErr string // Empty when the configuration is valid
+	}{
+		{name: "defaults", change: func(c *Config) {}},
+		{name: "no grpc url", change: func(c *Config) { c.GRPC.URLs = nil }, wantErr: "grpc.urls (GRPC_URL)"},
+		{name: "negative health check", change: func(c *Config) { c.GRPC.HealthCheckInterval = -1 }, wantErr: "grpc.health_check_interval"},
+		{name: "no contract", change: func(c *Config) { c.GRPC.ContractAddr = "" }, wantErr: "grpc.contract_addr (CONTRACT_ADDR)"},
+		{name: "negative keepalive", change: func(c *Config) { c.GRPC.KeepaliveTime = -1 }, wantErr: "grpc.keepalive_time"},
+		{name: "zero keepalive timeout", change: func(c *Config) { c.GRPC.KeepaliveTimeout = 0 }, wantErr: "grpc.keepalive_timeout"},
+		{name: "keepalive disabled", change: func(c *Config) { c.GRPC.KeepaliveTime, c.GRPC.KeepaliveTimeout = 0, 0 }},
+		{name: "tls files without tls", change: func(c *Config) { c.GRPC.TLS.CAFile = "ca.pem" }, wantErr: "grpc.tls.enabled (GRPC_TLS)"},
+		{name: "tls cert without key", change: func(c *Config) { c.GRPC.TLS = TLSConfig{Enabled: true, CertFile: "cert.pem"} }, wantErr: "must be set together"},
+		{name: "tls missing ca", change: func(c *Config) { c.GRPC.TLS = TLSConfig{Enabled: true, CAFile: "missing.pem"} }, wantErr: "grpc.tls.ca_file (GRPC_TLS_CA_FILE)"},
+		{name: "uppercase metadata", change: func(c *Config) { c.GRPC.Metadata = map[string]string{"X-Api-Key": "key"} }, wantErr: "grpc.metadata (GRPC_METADATA)"},
+		{name: "negative page size", change: func(c *Config) { c.Trees.PageSize = -1 }, wantErr: "trees.page_size (TREE_PAGE_SIZE)"},
+		{name: "bad metadata filter", change: func(c *Config) { c.Trees.MetadataFilter = "(" }, wantErr: "trees.metadata_filter (TREE_METADATA_FILTER)"},
+		{name: "bad order", change: func(c *Config) { c.Trees.Order = "random" }, wantErr: `trees.order (TREE_ORDER) must be newest, oldest or empty, got "random"`},
+		{name: "order", change: func(c *Config) { c.Trees.Order = "oldest" }},
+		{name: "negative cache ttl", change: func(c *Config) { c.Trees.CacheTTL = -1 }, wantErr: "trees.cache_ttl (TREE_CACHE_TTL) must not be negative"},
+		{name: "cache disabled", change: func(c *Config) { c.Trees.CacheTTL, c.Trees.CacheSize = 0, 0 }},
+		{name: "order without cache", change: func(c *Config) { c.Trees.CacheTTL, c.Trees.Order = 0, "newest" }, wantErr: "trees.cache_ttl (TREE_CACHE_TTL) must be positive"},
+		{name: "preferred tags without cache", change: func(c *Config) { c.Trees.CacheTTL, c.Trees.PreferTags = 0, []string{"a"} }, wantErr: "trees.cache_ttl (TREE_CACHE_TTL) must be positive"},
+		{name: "zero cache size", change: func(c *Config) { c.Trees.CacheSize = 0 }, wantErr: "trees.cache_size (TREE_CACHE_SIZE)"},
+		{name: "zero cache leaves", change: func(c *Config) { c.Trees.CacheMaxLeaves = 0 }, wantErr: "trees.cache_max_leaves (TREE_CACHE_MAX_LEAVES)"},
+		{name: "bad events url", change: func(c *Config) { c.Events.RPCURL = "ftp://localhost:26657" }, wantErr: "events.rpc_url (EVENTS_RPC_URL)"},
+		{name: "events url", change: func(c *Config) { c.Events.RPCURL = "ws://localhost:26657" }},
+		{name: "zero poll interval", change: func(c *Config) { c.Events.PollInterval = 0 }, wantErr: "events.poll_interval (EVENTS_POLL_INTERVAL)"},
+		{name: "proof without chain id", change: func(c *Config) { *c = *withProof(c); c.Proof.ChainID = "" }, wantErr: "proof.chain_id (PROOF_CHAIN_ID)"},
+		{name: "proof bad rpc url", change: func(c *Config) { *c = *withProof(c); c.Proof.RPCURL = "localhost:26657" }, wantErr: "proof.rpc_url (PROOF_RPC_URL)"},
+		{name: "proof without witnesses", change: func(c *Config) { *c = *withProof(c); c.Proof.Witnesses = nil }, wantErr: "proof.witnesses (PROOF_WITNESSES) must contain"},
+		{name: "proof bad witness", change: func(c *Config) { *c = *withProof(c); c.Proof.Witnesses = []string{"witness"} }, wantErr: `proof.witnesses (PROOF_WITNESSES): "witness"`},
+		{name: "proof zero height", change: func(c *Config) { *c = *withProof(c); c.Proof.TrustedHeight = 0 }, wantErr: "proof.trusted_height (PROOF_TRUSTED_HEIGHT)"},
+		{name: "proof short hash", change: func(c *Config) { *c = *withProof(c); c.Proof.TrustedHash = "abcd" }, wantErr: "proof.trusted_hash (PROOF_TRUSTED_HASH)"},
+		{name: "proof zero trusting period", change: func(c *Config) { *c = *withProof(c); c.Proof.TrustingPeriod = 0 }, wantErr: "proof.trusting_period (PROOF_TRUSTING_PERIOD)"},
+		{name: "proof without namespace", change: func(c *Config) { *c = *withProof(c); c.Proof.TreeNamespace = "" }, wantErr: "proof.tree_namespace (PROOF_TREE_NAMESPACE)"},
+		{name: "proof", change: func(c *Config) { *c = *withProof(c) }},
+		{name: "bad backend", change: func(c *Config) { c.Prover.Backend = "grpc" }, wantErr: `prover.backend (PROVER_BACKEND) must be http or merkle, got "grpc"`},
+		{name: "no prover url", change: func(c *Config) { c.Prover.URLs = nil }, wantErr: "prover.urls (ZK_PROVER_URL) must contain"},
+		{name: "bad prover url", change: func(c *Config) { c.Prover.URLs = []string{"127.0.0.1:3001"} }, wantErr: `prover.urls (ZK_PROVER_URL): "127.0.0.1:3001" is not an http(s) URL`},
+		{name: "merkle backend", change: func(c *Config) { c.Prover.Backend, c.Prover.URLs = "merkle", nil }},
+		{name: "bad points url", change: func(c *Config) { c.Points.URL = "https://" }, wantErr: "points.url (POINTS_API)"},
+		{name: "zero timeout", change: func(c *Config) { c.RequestTimeout = 0 }, wantErr: "request_timeout (API_REQUEST_TIMEOUT) must be at least 1s"},
+		{name: "sub second timeout", change: func(c *Config) { c.RequestTimeout = Duration(500 * time.Millisecond) }, wantErr: "request_timeout (API_REQUEST_TIMEOUT)"},
+		{name: "zero worker interval", change: func(c *Config) { c.Worker.Interval = 0 }, wantErr: "worker.interval (WORKER_INTERVAL)"},
+		{name: "negative stagger", change: func(c *Config) { c.Worker.StartStagger = -1 }, wantErr: "worker.start_stagger (WORKER_START_STAGGER)"},
+		{name: "zero sleep threshold", change: func(c *Config) { c.Sleep.Threshold = 0 }, wantErr: "sleep.threshold (SLEEP_THRESHOLD)"},
+		{name: "zero sleep duration", change: func(c *Config) { c.Sleep.Duration = 0 }, wantErr: "sleep.duration (SLEEP_DURATION)"},
+		{name: "bad sleep policy", change: func(c *Config) { c.Sleep.Policy = "linear" }, wantErr: `sleep.policy (SLEEP_POLICY) must be fixed or exponential, got "linear"`},
+		{name: "small backoff factor", change: func(c *Config) { c.Sleep.Policy, c.Sleep.BackoffFactor = "exponential", 0.5 }, wantErr: "sleep.backoff_factor (SLEEP_BACKOFF_FACTOR)"},
+		{name: "short max sleep", change: func(c *Config) { c.Sleep.Policy, c.Sleep.MaxDuration = "exponential", Duration(time.Minute) }, wantErr: "sleep.max_duration (SLEEP_MAX_DURATION)"},
+		{name: "exponential sleep", change: func(c *Config) { c.Sleep.Policy = "exponential" }},
+		{name: "bad log level", change: func(c *Config) { c.Log.Level = "trace" }, wantErr: `log.level (LOG_LEVEL) must be debug, info, warn or error, got "trace"`},
+		{name: "uppercase log level", change: func(c *Config) { c.Log.Level = "DEBUG" }},
+		{name: "bad log format", change: func(c *Config) { c.Log.Format = "xml" }, wantErr: `log.format (LOG_FORMAT) must be text or json, got "xml"`},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			cfg := Default()
+			tt.change(cfg)
+			err := cfg.Validate()
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("Validate: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("Validate = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+// withProof returns a copy of c verifying proofs with valid settings
+func withProof(c *Config) *Config {
+	copied := *c
+	copied.Proof = ProofConfig{
+		Enabled:        true,
+		ChainID:        "layeredge-testnet",
+		RPCURL:         "http://localhost:26657",
+		Witnesses:      []string{"https://rpc.example.com"},
+		TrustedHeight:  100,
+		TrustedHash:    strings.Repeat("ab", 32),
+		TrustingPeriod: Duration(time.Hour),
+		TreeNamespace:  "trees",
+	}
+	return &copied
+}
+
+func TestValidateReportsEveryError(t *testing.T) {
+	cfg := Default()
+	cfg.RequestTimeout = 0
+	cfg.Trees.Order = "random"
+	cfg.Points.URL = "points"
+
+	err := cfg.Validate()
+	if err == nil {
+		t.Fatal("Validate accepted an invalid configuration")
+	}
+	for _, want := range []string{"request_timeout", "trees.order", "points.url"} {
+		if !strings.Contains(err.Error(), want) {
+			t.Errorf("Validate error %q does not report %s", err, want)
+		}
+	}
+}
+
+// useTestEnv runs the test in an empty directory, so no .env file is read,
+// and unsets the environment variables of every setting
+func useTestEnv(t *testing.T) string {
+	t.Helper()
+	wd, err := os.Getwd()
+	if err != nil {
+		t.Fatalf("Getwd: %v", err)
+	}
+	dir := t.TempDir()
+	if err := os.Chdir(dir); err != nil {
+		t.Fatalf("Chdir: %v", err)
+	}
+	t.Cleanup(func() { os.Chdir(wd) })
+
+	for _, s := range append(settings, setting{env: "CONFIG_FILE"}) {
+		t.Setenv(s.env, "")
+		os.Unsetenv(s.env)
+	}
+	return dir
+}
+
+// exampleFiles returns the absolute paths of the example configuration files
+func exampleFiles(t *testing.T) []string {
+	t.Helper()
+	var paths []string
+	for _, name := range []string{"config.example.yaml", "config.example.toml"} {
+		path, err := filepath.Abs(filepath.Join("..", name))
+		if err != nil {
+			t.Fatalf("Abs: %v", err)
+		}
+		paths = append(paths, path)
+	}
+	return paths
+}
+
+func TestLoadDefaults(t *testing.T) {
+	useTestEnv(t)
+
+	cfg, err := Load(nil)
+	if err != nil {
+		t.Fatalf("Load: %v", err)
+	}
+	if !reflect.DeepEqual(cfg, Default()) {
+		t.Errorf("Load = %+v, want the defaults %+v", cfg, Default())
+	}
+}
+
+func TestLoadExampleFiles(t *testing.T) {
+	examples := exampleFiles(t)
+	useTestEnv(t)
+
+	var loaded []*Config
+	for _, path := range examples {
+		cfg, err := Load([]string{"-config", path})
+		if err != nil {
+			t.Fatalf("Load(%s): %v", filepath.Base(path), err)
+		}
+		loaded = append(loaded, cfg)
+	}
+	// The examples only differ from the defaults by the points API. The
+	// decoders leave their empty lists and maps either nil or empty.
+	want := Default()
+	want.Points.URL = "https://light-node.layeredge.io"
+	for i, cfg := range loaded {
+		if len(cfg.GRPC.Metadata) == 0 {
+			cfg.GRPC.Metadata = nil
+		}
+		for _, list := range []*[]string{&cfg.Trees.SkipTags, &cfg.Trees.Owners, &cfg.Trees.PreferTags, &cfg.Proof.Witnesses} {
+			if len(*list) == 0 {
+				*list = nil
+			}
+		}
+		if !reflect.DeepEqual(cfg, want) {
+			t.Errorf("%s = %+v, want %+v", filepath.Base(examples[i]), cfg, want)
+		}
+	}
+}
+
+func TestLoadPrecedence(t *testing.T) {
+	for _, path := range exampleFiles(t) {
+		t.Run(filepath.Ext(path), func(t *testing.T) {
+			dir := useTestEnv(t)
+			dotenv := "SLEEP_THRESHOLD=4\nSLEEP_DURATION=10m\nLOG_LEVEL=debug\n"
+			if err := os.WriteFile(filepath.Join(dir, EnvFile), []byte(dotenv), 0o600); err != nil {
+				t.Fatalf("WriteFile: %v", err)
+			}
+			t.Setenv("CONFIG_FILE", path)
+			t.Setenv("SLEEP_DURATION", "20m")
+			t.Setenv("WORKER_INTERVAL", "7s")
+
+			cfg, err := Load([]string{"-worker-interval", "9s", "-log-level", "warn"})
+			if err != nil {
+				t.Fatalf("Load: %v", err)
+			}
+			tests := []struct {
+				name string
+				got  interface{}
+				want interface{}
+			}{
+				{"default", cfg.Trees.CacheSize, 256},
+				{"file over default", cfg.Points.URL, "https://light-node.layeredge.io"},
+				{".env over file", cfg.Sleep.Threshold, 4},
+				{"environment over .env", cfg.Sleep.Duration, Duration(20 * time.Minute)},
+				{"flag over environment", cfg.Worker.Interval, Duration(9 * time.Second)},
+				{"flag over .env", cfg.Log.Level, "warn"},
+			}
+			for _, tt := range tests {
+				if tt.got != tt.want {
+					t.Errorf("%s: got %v, want %v", tt.name, tt.got, tt.want)
+				}
+			}
+
+			// -config overrides CONFIG_FILE
+			if _, err := Load([]string{"-config", filepath.Join(dir, "missing.yaml")}); err == nil || !strings.Contains(err.Error(), "missing.yaml") {
+				t.Errorf("Load with a missing -config file = %v, want an error naming it", err)
+			}
+		})
+	}
+}
+
+func TestLoadInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		file    string // Configuration file name and content, none when empty
+		content string
+		env     map[string]string
+		args    []string
+		wantErr string
+	}{
+		{name: "unknown yaml field", file: "config.yaml", content: "worker:\n  pace: 5s\n", wantErr: "field pace not found"},
+		{name: "unknown toml field", file: "config.toml", content: "[worker]\npace = \"5s\"\n", wantErr: "failed to parse config file"},
+		{name: "bad duration in file", file: "config.yaml", content: "worker:\n  interval: soon\n", wantErr: `invalid duration "soon"`},
+		{name: "bad environment value", env: map[string]string{"SLEEP_THRESHOLD": "three"}, wantErr: `invalid SLEEP_THRESHOLD: invalid integer "three"`},
+		{name: "bad flag value", args: []string{"-grpc-tls", "maybe"}, wantErr: `invalid -grpc-tls: invalid boolean "maybe"`},
+		{name: "unknown flag", args: []string{"-unknown"}, wantErr: "flag provided but not defined"},
+		{name: "extra argument", args: []string{"run"}, wantErr: "unexpected arguments: run"},
+		{name: "invalid value", env: map[string]string{"TREE_ORDER": "random"}, wantErr: "trees.order (TREE_ORDER)"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			dir := useTestEnv(t)
+			args := tt.args
+			if tt.file != "" {
+				path := filepath.Join(dir, tt.file)
+				if err := os.WriteFile(path, []byte(tt.content), 0o600); err != nil {
+					t.Fatalf("WriteFile: %v", err)
+				}
+				args = append([]string{"-config", path}, args...)
+			}
+			for key, value := range tt.env {
+				t.Setenv(key, value)
+			}
+
+			cfg, err := Load(args)
+			if err == nil || !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("Load = %+v, %v, want an error containing %q", cfg, err, tt.wantErr)
+			}
+		})
+	}
+}
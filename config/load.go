@@ -0,0 +1,303 @@
+package config
+
+import (
+	"bytes"
+	"errors"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"path/filepath"
+	"strconv"
+	"strings"
+	"time"
+
+	"github.com/joho/godotenv"
+	"github.com/pelletier/go-toml/v2"
+	"gopkg.in/yaml.v3"
+)
+
+// EnvFile is the dotenv file read next to the process environment. Variables
+// set in the process environment take precedence over it.
+const EnvFile = ".env"
+
+// setting maps one configuration value to its environment variable and
+// command line flag
+type setting struct {
+	env   string
+	flag  string // Empty when the setting cannot be passed as a flag
+	usage string
+	set   func(c *Config, value string) error
+}
+
+var settings = []setting{
+	{"GRPC_URL", "grpc-url", "comma separated gRPC endpoints of the chain", func(c *Config, value string) error {
+		c.GRPC.URLs = splitList(value)
+		return nil
+	}},
+	{"GRPC_HEALTH_CHECK_INTERVAL", "grpc-health-check-interval", "interval of the gRPC endpoint health probes, 0 to disable", setDuration(func(c *Config) *Duration { return &c.GRPC.HealthCheckInterval })},
+	{"CONTRACT_ADDR", "contract-addr", "address of the Merkle tree contract", setString(func(c *Config) *string { return &c.GRPC.ContractAddr })},
+	{"GRPC_KEEPALIVE_TIME", "grpc-keepalive-time", "ping interval of an idle gRPC connection, 0 to disable", setDuration(func(c *Config) *Duration { return &c.GRPC.KeepaliveTime })},
+	{"GRPC_KEEPALIVE_TIMEOUT", "grpc-keepalive-timeout", "time to wait for a gRPC ping answer", setDuration(func(c *Config) *Duration { return &c.GRPC.KeepaliveTimeout })},
+	{"GRPC_TLS", "grpc-tls", "connect to the gRPC endpoint over TLS", func(c *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		c.GRPC.TLS.Enabled = enabled
+		return nil
+	}},
+	{"GRPC_TLS_CA_FILE", "grpc-tls-ca-file", "PEM bundle of the CAs trusted for the gRPC endpoint, system roots when empty", setString(func(c *Config) *string { return &c.GRPC.TLS.CAFile })},
+	{"GRPC_TLS_CERT_FILE", "grpc-tls-cert-file", "client certificate for mutual TLS", setString(func(c *Config) *string { return &c.GRPC.TLS.CertFile })},
+	{"GRPC_TLS_KEY_FILE", "grpc-tls-key-file", "key of the client certificate", setString(func(c *Config) *string { return &c.GRPC.TLS.KeyFile })},
+	{"GRPC_TLS_SERVER_NAME", "grpc-tls-server-name", "name checked against the gRPC server certificate", setString(func(c *Config) *string { return &c.GRPC.TLS.ServerName })},
+	{"GRPC_METADATA", "", "", func(c *Config, value string) error {
+		// Comma separated key=value pairs, not a flag as it usually holds secrets
+		metadata := map[string]string{}
+		for _, pair := range splitList(value) {
+			key, val, ok := strings.Cut(pair, "=")
+			if !ok {
+				return fmt.Errorf("invalid metadata %q, expected key=value", pair)
+			}
+			metadata[strings.ToLower(strings.TrimSpace(key))] = strings.TrimSpace(val)
+		}
+		c.GRPC.Metadata = metadata
+		return nil
+	}},
+	{"TREE_PAGE_SIZE", "tree-page-size", "tree ids fetched per contract query, 0 fetches them all at once", setInt(func(c *Config) *int { return &c.Trees.PageSize })},
+	{"TREE_METADATA_FILTER", "tree-metadata-filter", "regular expression the tree metadata must match, empty samples every tree", setString(func(c *Config) *string { return &c.Trees.MetadataFilter })},
+	{"TREE_SKIP_TAGS", "tree-skip-tags", "comma separated tags of the trees to skip", func(c *Config, value string) error {
+		c.Trees.SkipTags = splitList(value)
+		return nil
+	}},
+	{"TREE_OWNERS", "tree-owners", "comma separated owners of the trees to sample, empty samples every owner", func(c *Config, value string) error {
+		c.Trees.Owners = splitList(value)
+		return nil
+	}},
+	{"TREE_PREFER_TAGS", "tree-prefer-tags", "comma separated tags of the trees to work on first, in order of preference", func(c *Config, value string) error {
+		c.Trees.PreferTags = splitList(value)
+		return nil
+	}},
+	{"TREE_ORDER", "tree-order", "newest or oldest created_height first, empty keeps the contract order", setString(func(c *Config) *string { return &c.Trees.Order })},
+	{"TREE_CACHE_TTL", "tree-cache-ttl", "time fetched trees are shared between workers, 0 to disable the cache", setDuration(func(c *Config) *Duration { return &c.Trees.CacheTTL })},
+	{"TREE_CACHE_SIZE", "tree-cache-size", "maximum number of cached trees", setInt(func(c *Config) *int { return &c.Trees.CacheSize })},
+	{"TREE_CACHE_MAX_LEAVES", "tree-cache-max-leaves", "maximum number of leaves of all cached trees", setInt(func(c *Config) *int { return &c.Trees.CacheMaxLeaves })},
+	{"EVENTS_RPC_URL", "events-rpc-url", "CometBFT RPC address to subscribe to contract events, empty to only poll", setString(func(c *Config) *string { return &c.Events.RPCURL })},
+	{"EVENTS_POLL_INTERVAL", "events-poll-interval", "pause between two polls while the event subscription is live", setDuration(func(c *Config) *Duration { return &c.Events.PollInterval })},
+	{"PROOF_VERIFY", "proof-verify", "verify the trees with storage proofs against light client headers", func(c *Config, value string) error {
+		enabled, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		c.Proof.Enabled = enabled
+		return nil
+	}},
+	{"PROOF_CHAIN_ID", "proof-chain-id", "chain id checked by the light client", setString(func(c *Config) *string { return &c.Proof.ChainID })},
+	{"PROOF_RPC_URL", "proof-rpc-url", "primary CometBFT RPC of the light client", setString(func(c *Config) *string { return &c.Proof.RPCURL })},
+	{"PROOF_WITNESSES", "proof-witnesses", "comma separated CometBFT RPCs cross-checking the primary", func(c *Config, value string) error {
+		c.Proof.Witnesses = splitList(value)
+		return nil
+	}},
+	{"PROOF_TRUSTED_HEIGHT", "proof-trusted-height", "height of the header trusted by the light client", func(c *Config, value string) error {
+		height, err := strconv.ParseInt(value, 10, 64)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		c.Proof.TrustedHeight = height
+		return nil
+	}},
+	{"PROOF_TRUSTED_HASH", "proof-trusted-hash", "hex hash of the header trusted by the light client", setString(func(c *Config) *string { return &c.Proof.TrustedHash })},
+	{"PROOF_TRUSTING_PERIOD", "proof-trusting-period", "trusting period of the light client, shorter than the unbonding period", setDuration(func(c *Config) *Duration { return &c.Proof.TrustingPeriod })},
+	{"PROOF_TREE_NAMESPACE", "proof-tree-namespace", "storage namespace of the tree map of the contract", setString(func(c *Config) *string { return &c.Proof.TreeNamespace })},
+	{"PROVER_BACKEND", "prover-backend", "prover backend: http or merkle", setString(func(c *Config) *string { return &c.Prover.Backend })},
+	{"ZK_PROVER_URL", "prover-url", "comma separated prover URLs, in priority order", func(c *Config, value string) error {
+		c.Prover.URLs = splitList(value)
+		return nil
+	}},
+	{"POINTS_API", "points-api", "URL of the points API", setString(func(c *Config) *string { return &c.Points.URL })},
+	{"API_REQUEST_TIMEOUT", "request-timeout", "timeout of prover and points API requests, in seconds or as a duration", func(c *Config, value string) error {
+		// Plain numbers are seconds, as in earlier releases
+		if seconds, err := strconv.Atoi(value); err == nil {
+			c.RequestTimeout = Duration(time.Duration(seconds) * time.Second)
+			return nil
+		}
+		return c.RequestTimeout.UnmarshalText([]byte(value))
+	}},
+	{"PRIVATE_KEY", "", "", setString(func(c *Config) *string { return &c.PrivateKey })},
+	{"WORKER_INTERVAL", "worker-interval", "pause between two runs of a worker", setDuration(func(c *Config) *Duration { return &c.Worker.Interval })},
+	{"WORKER_START_STAGGER", "worker-start-stagger", "delay between starting two workers", setDuration(func(c *Config) *Duration { return &c.Worker.StartStagger })},
+	{"SLEEP_POLICY", "sleep-policy", "sleep policy of unchanged trees: fixed or exponential", setString(func(c *Config) *string { return &c.Sleep.Policy })},
+	{"SLEEP_THRESHOLD", "sleep-threshold", "number of identical roots before a tree sleeps", setInt(func(c *Config) *int { return &c.Sleep.Threshold })},
+	{"SLEEP_DURATION", "sleep-duration", "sleep duration of unchanged trees", setDuration(func(c *Config) *Duration { return &c.Sleep.Duration })},
+	{"SLEEP_BACKOFF_FACTOR", "sleep-backoff-factor", "multiplier of the exponential sleep policy", func(c *Config, value string) error {
+		factor, err := strconv.ParseFloat(value, 64)
+		if err != nil {
+			return fmt.Errorf("invalid number %q", value)
+		}
+		c.Sleep.BackoffFactor = factor
+		return nil
+	}},
+	{"SLEEP_MAX_DURATION", "sleep-max-duration", "maximum sleep of the exponential sleep policy", setDuration(func(c *Config) *Duration { return &c.Sleep.MaxDuration })},
+	{"TREE_STATE_FILE", "tree-state-file", "file persisting tree states, empty to keep them in memory", setString(func(c *Config) *string { return &c.Files.TreeState })},
+	{"LEDGER_FILE", "ledger-file", "submission ledger file, empty to keep it in memory", setString(func(c *Config) *string { return &c.Files.Ledger })},
+	{"OUTBOX_FILE", "outbox-file", "outbox file of failed submissions, empty to keep it in memory", setString(func(c *Config) *string { return &c.Files.Outbox })},
+	{"METRICS_ADDR", "metrics-addr", "listen address of the Prometheus metrics, empty to disable", setString(func(c *Config) *string { return &c.MetricsAddr })},
+	{"STATUS_ADDR", "status-addr", "listen address of the status API, empty to disable", setString(func(c *Config) *string { return &c.StatusAddr })},
+	{"LOG_LEVEL", "log-level", "log level: debug, info, warn or error", setString(func(c *Config) *string { return &c.Log.Level })},
+	{"LOG_FORMAT", "log-format", "log format: text or json", setString(func(c *Config) *string { return &c.Log.Format })},
+	{"CONFIG_WATCH", "watch", "reload the prover, timeout and sleep settings when the config or .env file changes", func(c *Config, value string) error {
+		watch, err := strconv.ParseBool(value)
+		if err != nil {
+			return fmt.Errorf("invalid boolean %q", value)
+		}
+		c.Watch = watch
+		return nil
+	}},
+}
+
+func setString(field func(c *Config) *string) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		*field(c) = value
+		return nil
+	}
+}
+
+func setInt(field func(c *Config) *int) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		parsed, err := strconv.Atoi(value)
+		if err != nil {
+			return fmt.Errorf("invalid integer %q", value)
+		}
+		*field(c) = parsed
+		return nil
+	}
+}
+
+func setDuration(field func(c *Config) *Duration) func(c *Config, value string) error {
+	return func(c *Config, value string) error {
+		return field(c).UnmarshalText([]byte(value))
+	}
+}
+
+func splitList(value string) []string {
+	var items []string
+	for _, item := range strings.Split(value, ",") {
+		if item = strings.TrimSpace(item); item != "" {
+			items = append(items, item)
+		}
+	}
+	return items
+}
+
+// Load builds the configuration from, in increasing priority, the defaults,
+// the configuration file, the environment (including .env) and the command
+// line flags in args. The file is given by -config or CONFIG_FILE and is read
+// as TOML when it ends in .toml and as YAML otherwise. The result is
+// validated.
+func Load(args []string) (*Config, error) {
+	cfg, _, err := load(args)
+	return cfg, err
+}
+
+// readEnv returns a lookup function over the process environment and the
+// variables of EnvFile
+func readEnv() (func(key string) (string, bool), error) {
+	dotenv, err := godotenv.Read(EnvFile)
+	if err != nil && !errors.Is(err, os.ErrNotExist) {
+		return nil, fmt.Errorf("failed to read %s: %v", EnvFile, err)
+	}
+
+	return func(key string) (string, bool) {
+		if value, exists := os.LookupEnv(key); exists {
+			return value, true
+		}
+		value, exists := dotenv[key]
+		return value, exists
+	}, nil
+}
+
+// load is Load that also returns the path of the configuration file
+func load(args []string) (*Config, string, error) {
+	lookupEnv, err := readEnv()
+	if err != nil {
+		return nil, "", err
+	}
+
+	flags := flag.NewFlagSet("light-node", flag.ContinueOnError)
+	defaultPath, _ := lookupEnv("CONFIG_FILE")
+	path := flags.String("config", defaultPath, "configuration file (YAML or TOML)")
+
+	type flagValue struct {
+		setting setting
+		value   string
+	}
+	var flagValues []flagValue
+	for _, s := range settings {
+		if s.flag == "" {
+			continue
+		}
+		flags.Func(s.flag, s.usage+" (overrides "+s.env+")", func(value string) error {
+			flagValues = append(flagValues, flagValue{s, value})
+			return nil
+		})
+	}
+	if err := flags.Parse(args); err != nil {
+		return nil, "", err
+	}
+	if flags.NArg() > 0 {
+		return nil, "", fmt.Errorf("unexpected arguments: %s", strings.Join(flags.Args(), " "))
+	}
+
+	cfg := Default()
+	if *path != "" {
+		if err := cfg.loadFile(*path); err != nil {
+			return nil, "", err
+		}
+	}
+
+	for _, s := range settings {
+		if value, exists := lookupEnv(s.env); exists {
+			if err := s.set(cfg, value); err != nil {
+				return nil, "", fmt.Errorf("invalid %s: %v", s.env, err)
+			}
+		}
+	}
+
+	for _, f := range flagValues {
+		if err := f.setting.set(cfg, f.value); err != nil {
+			return nil, "", fmt.Errorf("invalid -%s: %v", f.setting.flag, err)
+		}
+	}
+
+	if err := cfg.Validate(); err != nil {
+		return nil, "", err
+	}
+	return cfg, *path, nil
+}
+
+// loadFile overrides the configuration with the settings present in the file
+func (c *Config) loadFile(path string) error {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return fmt.Errorf("failed to read config file %s: %v", path, err)
+	}
+
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".toml":
+		decoder := toml.NewDecoder(bytes.NewReader(data))
+		decoder.DisallowUnknownFields()
+		err = decoder.Decode(c)
+	default:
+		decoder := yaml.NewDecoder(bytes.NewReader(data))
+		decoder.KnownFields(true)
+		err = decoder.Decode(c)
+		if errors.Is(err, io.EOF) {
+			// Empty file
+			err = nil
+		}
+	}
+	if err != nil {
+		return fmt.Errorf("failed to parse config file %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,10 @@
+package config
+
+import "log/slog"
+
+var logger = slog.Default()
+
+// SetLogger replaces the logger used by the config package
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
@@ -0,0 +1,143 @@
+package config
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"reflect"
+	"sync/atomic"
+	"time"
+
+	"github.com/fsnotify/fsnotify"
+)
+
+// reloadDelay groups the bursts of events editors produce when saving a file
+const reloadDelay = 500 * time.Millisecond
+
+// Store holds the current configuration. A snapshot returned by Current is
+// never modified; a reload swaps in a new one, so long running code should
+// fetch a fresh snapshot for every unit of work.
+type Store struct {
+	args    []string
+	path    string
+	current atomic.Pointer[Config]
+}
+
+// NewStore loads the configuration like Load and keeps args to reload it
+func NewStore(args []string) (*Store, error) {
+	cfg, path, err := load(args)
+	if err != nil {
+		return nil, err
+	}
+
+	store := &Store{args: args, path: path}
+	store.current.Store(cfg)
+	return store, nil
+}
+
+// Current returns the current configuration snapshot
+func (s *Store) Current() *Config {
+	return s.current.Load()
+}
+
+// Reload reads the configuration file and .env again and applies the
+// settings that can change at runtime: the prover, the request timeout and
+// the sleep policy. An invalid configuration is rejected and the current one
+// kept.
+func (s *Store) Reload() error {
+	next, _, err := load(s.args)
+	if err != nil {
+		return err
+	}
+
+	current := s.Current()
+	updated := *current
+	updated.Prover = next.Prover
+	updated.RequestTimeout = next.RequestTimeout
+	updated.Sleep = next.Sleep
+
+	changes := []struct {
+		name     string
+		old, new interface{}
+	}{
+		{"prover.backend", current.Prover.Backend, next.Prover.Backend},
+		{"prover.urls", current.Prover.URLs, next.Prover.URLs},
+		{"request_timeout", current.RequestTimeout, next.RequestTimeout},
+		{"sleep.policy", current.Sleep.Policy, next.Sleep.Policy},
+		{"sleep.threshold", current.Sleep.Threshold, next.Sleep.Threshold},
+		{"sleep.duration", current.Sleep.Duration, next.Sleep.Duration},
+		{"sleep.backoff_factor", current.Sleep.BackoffFactor, next.Sleep.BackoffFactor},
+		{"sleep.max_duration", current.Sleep.MaxDuration, next.Sleep.MaxDuration},
+	}
+	changed := false
+	for _, change := range changes {
+		if !reflect.DeepEqual(change.old, change.new) {
+			logger.Info("configuration changed", "setting", change.name,
+				"old", fmt.Sprint(change.old), "new", fmt.Sprint(change.new))
+			changed = true
+		}
+	}
+	if !reflect.DeepEqual(&updated, next) {
+		logger.Warn("configuration file changed settings that only apply after a restart")
+	}
+
+	if changed {
+		s.current.Store(&updated)
+	}
+	return nil
+}
+
+// Watch reloads the configuration whenever the configuration file or .env
+// changes, until ctx is cancelled
+func (s *Store) Watch(ctx context.Context) error {
+	watcher, err := fsnotify.NewWatcher()
+	if err != nil {
+		return fmt.Errorf("failed to create file watcher: %v", err)
+	}
+	defer watcher.Close()
+
+	// Watch the directories rather than the files, as many editors replace
+	// a file instead of writing to it
+	files := map[string]bool{}
+	for _, path := range []string{s.path, EnvFile} {
+		if path == "" {
+			continue
+		}
+		abs, err := filepath.Abs(path)
+		if err != nil {
+			return fmt.Errorf("invalid path %s: %v", path, err)
+		}
+		files[abs] = true
+		if err := watcher.Add(filepath.Dir(abs)); err != nil {
+			return fmt.Errorf("failed to watch %s: %v", filepath.Dir(abs), err)
+		}
+	}
+	logger.Info("watching configuration files for changes")
+
+	timer := time.NewTimer(reloadDelay)
+	timer.Stop()
+	defer timer.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case event, ok := <-watcher.Events:
+			if !ok {
+				return nil
+			}
+			if path, err := filepath.Abs(event.Name); err == nil && files[path] {
+				timer.Reset(reloadDelay)
+			}
+		case err, ok := <-watcher.Errors:
+			if !ok {
+				return nil
+			}
+			logger.Warn("configuration file watcher error", "error", err)
+		case <-timer.C:
+			if err := s.Reload(); err != nil {
+				logger.Error("failed to reload configuration, keeping the current one", "error", err)
+			}
+		}
+	}
+}
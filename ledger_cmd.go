@@ -0,0 +1,95 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"flag"
+	"fmt"
+	"io"
+	"os"
+	"strings"
+	"time"
+
+	"github.com/Layer-Edge/light-node/config"
+	"github.com/Layer-Edge/light-node/node"
+)
+
+// runLedgerCommand implements the "ledger" subcommand, which lists or exports
+// the recorded submissions:
+//
+//	light-node ledger [-file submissions.jsonl] [-wallet addr] [-tree id] [-format table|json|csv] [-o path]
+func runLedgerCommand(cfg *config.Config, args []string) error {
+	flags := flag.NewFlagSet("ledger", flag.ContinueOnError)
+	file := flags.String("file", cfg.Files.Ledger, "ledger file to read")
+	wallet := flags.String("wallet", "", "only show submissions of this wallet address")
+	tree := flags.String("tree", "", "only show submissions of this tree id")
+	format := flags.String("format", "table", "output format: table, json or csv")
+	output := flags.String("o", "", "write to this file instead of stdout")
+	if err := flags.Parse(args); err != nil {
+		return err
+	}
+
+	records, err := node.ReadLedger(*file)
+	if err != nil {
+		return fmt.Errorf("failed to read ledger: %v", err)
+	}
+
+	var filtered []node.SubmissionRecord
+	for _, record := range records {
+		if *wallet != "" && !strings.EqualFold(record.WalletAddress, *wallet) {
+			continue
+		}
+		if *tree != "" && record.TreeId != *tree {
+			continue
+		}
+		filtered = append(filtered, record)
+	}
+
+	var out io.Writer = os.Stdout
+	if *output != "" {
+		f, err := os.Create(*output)
+		if err != nil {
+			return fmt.Errorf("failed to create %s: %v", *output, err)
+		}
+		defer f.Close()
+		out = f
+	}
+
+	switch *format {
+	case "table":
+		for _, record := range filtered {
+			fmt.Fprintf(out, "%s  %s  tree=%s  root=%s  leaf=%s\n",
+				record.Timestamp.Format(time.RFC3339), record.WalletAddress, record.TreeId, record.Root, record.Leaf)
+		}
+		fmt.Fprintf(out, "%d submissions\n", len(filtered))
+	case "json":
+		encoder := json.NewEncoder(out)
+		encoder.SetIndent("", "  ")
+		if filtered == nil {
+			filtered = []node.SubmissionRecord{}
+		}
+		return encoder.Encode(filtered)
+	case "csv":
+		writer := csv.NewWriter(out)
+		writer.Write([]string{"timestamp", "wallet_address", "tree_id", "root", "leaf", "proof_hash", "receipt", "response"})
+		for _, record := range filtered {
+			response, _ := json.Marshal(record.Response)
+			writer.Write([]string{
+				record.Timestamp.Format(time.RFC3339),
+				record.WalletAddress,
+				record.TreeId,
+				record.Root,
+				record.Leaf,
+				record.ProofHash,
+				record.Receipt,
+				string(response),
+			})
+		}
+		writer.Flush()
+		return writer.Error()
+	default:
+		return fmt.Errorf("unknown format %q, expected table, json or csv", *format)
+	}
+
+	return nil
+}
@@ -2,140 +2,354 @@ package main
 
 import (
 	"context"
+	"encoding/hex"
+	"errors"
+	"flag"
 	"fmt"
-	"log"
+	"log/slog"
 	"os"
 	"os/signal"
+	"slices"
 	"sync"
 	"syscall"
 	"time"
 
+	"github.com/Layer-Edge/light-node/clients"
+	"github.com/Layer-Edge/light-node/config"
 	"github.com/Layer-Edge/light-node/node"
 	"github.com/Layer-Edge/light-node/utils"
-	"github.com/joho/godotenv"
 )
 
-func Worker(ctx context.Context, wg *sync.WaitGroup, id int, proxy string) {
+var logger = slog.Default()
+
+// fatal logs the error and exits, like log.Fatal
+func fatal(msg string, err error) {
+	logger.Error(msg, "error", err)
+	os.Exit(1)
+}
+
+// clientConfig returns the gRPC client configuration of cfg
+func clientConfig(cfg *config.Config) clients.ClientConfig {
+	if len(cfg.GRPC.Metadata) > 0 && !cfg.GRPC.TLS.Enabled {
+		logger.Warn("gRPC metadata is sent over a plaintext connection, enable GRPC_TLS for remote endpoints")
+	}
+
+	// Validated with the configuration
+	trustedHash, _ := hex.DecodeString(cfg.Proof.TrustedHash)
+
+	return clients.ClientConfig{
+		GrpcURLs:            cfg.GRPC.URLs,
+		ContractAddr:        cfg.GRPC.ContractAddr,
+		HealthCheckInterval: cfg.GRPC.HealthCheckInterval.Duration(),
+		KeepaliveTime:       cfg.GRPC.KeepaliveTime.Duration(),
+		KeepaliveTimeout:    cfg.GRPC.KeepaliveTimeout.Duration(),
+		TLS: clients.TLSConfig{
+			Enabled:    cfg.GRPC.TLS.Enabled,
+			CAFile:     cfg.GRPC.TLS.CAFile,
+			CertFile:   cfg.GRPC.TLS.CertFile,
+			KeyFile:    cfg.GRPC.TLS.KeyFile,
+			ServerName: cfg.GRPC.TLS.ServerName,
+		},
+		Metadata:           cfg.GRPC.Metadata,
+		TreePageSize:       uint32(cfg.Trees.PageSize),
+		TreeCacheTTL:       cfg.Trees.CacheTTL.Duration(),
+		TreeCacheSize:      cfg.Trees.CacheSize,
+		TreeCacheMaxLeaves: cfg.Trees.CacheMaxLeaves,
+		Proof: clients.ProofConfig{
+			Enabled:        cfg.Proof.Enabled,
+			ChainID:        cfg.Proof.ChainID,
+			RPCURL:         cfg.Proof.RPCURL,
+			Witnesses:      cfg.Proof.Witnesses,
+			TrustedHeight:  cfg.Proof.TrustedHeight,
+			TrustedHash:    trustedHash,
+			TrustingPeriod: cfg.Proof.TrustingPeriod.Duration(),
+			TreeNamespace:  cfg.Proof.TreeNamespace,
+		},
+	}
+}
+
+func Worker(ctx context.Context, wg *sync.WaitGroup, store *config.Store, cosmosQueryClient *clients.CosmosQueryClient, id int, identity *node.Identity, prover node.Prover, proxy string, queue *node.TreeQueue) {
 	defer wg.Done()
+	log := logger.With("worker", id, "wallet", identity.Address())
+	proverCfg := store.Current()
 	for {
 		select {
 		case <-ctx.Done():
-			fmt.Printf("Worker %d is shutting down\n", id)
+			log.Info("worker is shutting down")
 			return
 		default:
-			fmt.Printf("Worker %d is running with proxy %s...\n", id, proxy)
-			node.CollectSampleAndVerify(id, proxy)
-			time.Sleep(5 * time.Second)
+			// Every run uses the latest configuration snapshot, rebuilding the
+			// prover when the configuration was reloaded
+			cfg := store.Current()
+			if cfg != proverCfg {
+				if reloaded, err := node.NewProver(cfg, proxy); err != nil {
+					log.Error("failed to create prover from reloaded configuration", "error", err)
+				} else {
+					prover, proverCfg = reloaded, cfg
+				}
+			}
+
+			changed := queue.Take()
+			log.Debug("worker is running", "proxy", proxy != "", "changed_trees", len(changed))
+			completed := node.CollectSampleAndVerify(ctx, cfg, cosmosQueryClient, id, identity, prover, proxy, changed)
+			// A run completes at most one tree, requeue the changed trees it
+			// did not get to
+			if i := slices.Index(changed, completed); i >= 0 && i+1 < len(changed) {
+				queue.Push(changed[i+1:])
+			}
+
+			// While contract events are live, wait for the next change and
+			// only poll at the slower events pace
+			interval := cfg.Worker.Interval.Duration()
+			if queue.Live() {
+				interval = cfg.Events.PollInterval.Duration()
+			}
+			select {
+			case <-ctx.Done():
+			case <-queue.Ready():
+			case <-time.After(interval):
+			}
 		}
 	}
 }
 
 func main() {
+	// Subcommands parse their own flags, the node itself takes configuration
+	// flags
+	command, args := "", os.Args[1:]
+	if len(args) > 0 && (args[0] == "check-proxy" || args[0] == "ledger") {
+		command, args = args[0], nil
+	}
+
+	// The environment and .env are read once here; later changes only apply
+	// through a reload of the store
+	store, err := config.NewStore(args)
+	if errors.Is(err, flag.ErrHelp) {
+		return
+	} else if err != nil {
+		fmt.Fprintln(os.Stderr, err)
+		os.Exit(2)
+	}
+	cfg := store.Current()
+
+	// Configure structured logging for every package before doing any work
+	logger, err = utils.NewLogger(os.Stderr, cfg.Log.Format, cfg.Log.Level)
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "Invalid logging configuration:", err)
+		os.Exit(1)
+	}
+	slog.SetDefault(logger)
+	node.SetLogger(logger)
+	clients.SetLogger(logger)
+	utils.SetLogger(logger)
+	config.SetLogger(logger)
+
 	// Kiểm tra tham số dòng lệnh
-	if len(os.Args) > 1 && os.Args[1] == "check-proxy" {
-		log.Println("Kiểm tra tất cả các proxy...")
+	if command == "check-proxy" {
+		logger.Info("checking all proxies")
 		results, err := utils.CheckAllProxies()
 		if err != nil {
-			log.Fatalf("Lỗi khi kiểm tra proxy: %v", err)
+			fatal("failed to check proxies", err)
 		}
 
-		// Hiển thị kết quả
-		log.Println("Kết quả kiểm tra proxy:")
 		for proxy, result := range results {
-			log.Printf("%s: %s", proxy, result)
+			logger.Info("proxy checked", "proxy", proxy, "result", result)
 		}
 		return
 	}
 
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Warning: Error loading .env file, will try to use wallet.txt")
+	if command == "ledger" {
+		if err := runLedgerCommand(cfg, os.Args[2:]); err != nil {
+			fatal("ledger command failed", err)
+		}
+		return
 	}
 
 	// Load all private keys and display their public keys and addresses
-	privKeys, err := utils.LoadPrivateKeysFromFile()
-	if err != nil {
-		log.Fatal("Error loading private keys: ", err)
-	}
-
-	pubKeys, err := utils.GetAllCompressedPublicKeys()
+	privKeys, err := utils.LoadPrivateKeysFromFile(cfg.PrivateKey)
 	if err != nil {
-		log.Fatal("Error getting public keys: ", err)
+		fatal("failed to load private keys", err)
 	}
 
-	addresses, err := utils.GetAllWalletAddresses()
+	// Each worker owns exactly one identity so the submitted wallet address
+	// always matches the key that signed the submission
+	identities, err := node.LoadIdentities(privKeys)
 	if err != nil {
-		log.Fatal("Error getting wallet addresses: ", err)
+		fatal("failed to load wallet identities", err)
 	}
 
-	log.Printf("Loaded %d private keys from wallet.txt", len(privKeys))
-	for i, pubKey := range pubKeys {
-		log.Printf("Key %d - Compressed Public Key: %s, Address: %s", i+1, pubKey, addresses[i])
+	logger.Info("loaded private keys", "count", len(identities))
+	for i, identity := range identities {
+		logger.Info("loaded wallet", "key", i+1, "public_key", identity.CompressedPublicKey(), "wallet", identity.Address())
 	}
 
 	// Lưu public keys và địa chỉ ví vào file publickey.txt
 	file, err := os.Create("publickey.txt")
 	if err != nil {
-		log.Println("Warning: Error creating publickey.txt file: ", err)
+		logger.Warn("failed to create publickey.txt", "error", err)
 	} else {
 		defer file.Close()
-		for i, pubKey := range pubKeys {
-			_, err := file.WriteString(fmt.Sprintf("Key %d - Compressed Public Key: %s, Address: %s\n", i+1, pubKey, addresses[i]))
+		for i, identity := range identities {
+			_, err := file.WriteString(fmt.Sprintf("Key %d - Compressed Public Key: %s, Address: %s\n", i+1, identity.CompressedPublicKey(), identity.Address()))
 			if err != nil {
-				log.Println("Warning: Error writing to publickey.txt file: ", err)
+				logger.Warn("failed to write publickey.txt", "error", err)
 				break
 			}
 		}
-		log.Println("Public keys and addresses saved to publickey.txt")
+		logger.Info("public keys and addresses saved to publickey.txt")
+	}
+
+	// Persist tree states so sleeping trees and known roots survive restarts
+	if stateFile := cfg.Files.TreeState; stateFile != "" {
+		store, err := node.NewFileTreeStateStore(stateFile)
+		if err != nil {
+			fatal("failed to open tree state store", err)
+		}
+		node.SetTreeStateStore(store)
+		logger.Info("tree states are persisted", "file", stateFile)
+	}
+
+	// Record submissions so already submitted leaves are not proven again
+	submissionLedger, err := node.OpenLedger(cfg.Files.Ledger)
+	if err != nil {
+		fatal("failed to open submission ledger", err)
+	}
+	defer submissionLedger.Close()
+	node.SetLedger(submissionLedger)
+
+	// Keep failed submissions on disk so they can be retried later
+	submissionOutbox, err := node.OpenOutbox(cfg.Files.Outbox)
+	if err != nil {
+		fatal("failed to open submission outbox", err)
+	}
+	node.SetOutbox(submissionOutbox)
+	if pending := len(submissionOutbox.Entries()); pending > 0 {
+		logger.Info("failed submissions are waiting to be retried", "count", pending)
 	}
 
 	// Load proxies
 	proxies, err := utils.LoadProxiesFromFile()
 	if err != nil {
-		log.Println("Warning: Error loading proxies: ", err)
-		log.Println("Will run without proxies")
+		logger.Warn("failed to load proxies, will run without proxies", "error", err)
 		// Create empty proxies to match the number of private keys
-		proxies = make([]string, len(privKeys))
+		proxies = make([]string, len(identities))
 	}
 
 	// Make sure we have enough proxies for all private keys
 	// If not enough proxies, reuse them in a round-robin fashion
-	if len(proxies) < len(privKeys) {
-		log.Printf("Warning: Not enough proxies (%d) for all private keys (%d). Will reuse proxies.", len(proxies), len(privKeys))
+	if len(proxies) < len(identities) {
+		logger.Warn("not enough proxies for all identities, will reuse proxies", "proxies", len(proxies), "identities", len(identities))
 		originalProxies := make([]string, len(proxies))
 		copy(originalProxies, proxies)
 
-		for i := len(proxies); i < len(privKeys); i++ {
+		for i := len(proxies); i < len(identities); i++ {
 			proxyIndex := i % len(originalProxies)
 			proxies = append(proxies, originalProxies[proxyIndex])
 		}
 	}
 
+	// One gRPC connection is shared by every worker for the lifetime of the
+	// process
+	cosmosQueryClient, err := clients.NewCosmosQueryClient(clientConfig(cfg))
+	if err != nil {
+		fatal("failed to create gRPC client", err)
+	}
+	defer cosmosQueryClient.Close()
+
 	ctx, cancel := context.WithCancel(context.Background())
 	defer cancel()
 
 	var wg sync.WaitGroup
 
+	wg.Add(2)
+	go func() {
+		defer wg.Done()
+		cosmosQueryClient.MonitorConnection(ctx)
+	}()
+	go func() {
+		defer wg.Done()
+		cosmosQueryClient.RunHealthChecks(ctx)
+	}()
+
 	signalChan := make(chan os.Signal, 1)
-	signal.Notify(signalChan, syscall.SIGABRT, syscall.SIGTERM)
+	signal.Notify(signalChan, syscall.SIGINT, syscall.SIGABRT, syscall.SIGTERM)
+
+	// Expose Prometheus metrics when a listen address is configured
+	if metricsAddr := cfg.MetricsAddr; metricsAddr != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := node.ServeMetrics(ctx, metricsAddr); err != nil {
+				logger.Error("metrics server stopped", "error", err)
+			}
+		}()
+	}
 
-	// Start a worker for each private key
-	for i := 0; i < len(privKeys); i++ {
+	// Serve the local status API, bound to localhost unless configured otherwise
+	if cfg.StatusAddr != "" {
 		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := node.ServeStatus(ctx, store, cosmosQueryClient); err != nil {
+				logger.Error("status API stopped", "error", err)
+			}
+		}()
+	}
+
+	// Retry failed submissions in the background
+	wg.Add(1)
+	go func() {
+		defer wg.Done()
+		submissionOutbox.Run(ctx, store, identities)
+	}()
+
+	// Hot reload the prover, timeout and sleep settings when enabled
+	if cfg.Watch {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			if err := store.Watch(ctx); err != nil {
+				logger.Error("configuration watcher stopped", "error", err)
+			}
+		}()
+	}
+
+	// Push the trees changed on chain to the workers when a CometBFT RPC
+	// node is configured
+	queues := make([]*node.TreeQueue, len(identities))
+	for i := range queues {
+		queues[i] = node.NewTreeQueue()
+	}
+	if cfg.Events.RPCURL != "" {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			node.WatchContractEvents(ctx, cfg.Events.RPCURL, cfg.GRPC.ContractAddr, cosmosQueryClient, queues)
+		}()
+	}
+
+	// Start a worker for each identity
+	for i, identity := range identities {
 		proxy := ""
 		if i < len(proxies) {
 			proxy = utils.FormatProxyURL(proxies[i])
 		}
-		go Worker(ctx, &wg, i+1, proxy)
+		prover, err := node.NewProver(cfg, proxy)
+		if err != nil {
+			fatal("failed to create prover", err)
+		}
+		wg.Add(1)
+		go Worker(ctx, &wg, store, cosmosQueryClient, i+1, identity, prover, proxy, queues[i])
 		// Add a small delay between starting workers to avoid overwhelming the system
-		time.Sleep(500 * time.Millisecond)
+		time.Sleep(cfg.Worker.StartStagger.Duration())
 	}
 
 	<-signalChan
-	fmt.Println("\nReceived interrupt signal. Shutting down gracefully...")
+	logger.Info("received interrupt signal, shutting down gracefully")
 
+	// Cancelling the context aborts in-flight prover and submission requests
 	cancel()
 
 	wg.Wait()
-	fmt.Println("All workers have shut down. Exiting..")
+	logger.Info("all workers have shut down, exiting")
 }
@@ -0,0 +1,206 @@
+package merkle
+
+import (
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+)
+
+// Tree mirrors the MerkleTree built by the RISC Zero guest
+// (risc0-merkle-service/methods/guest/src/main.rs) so that roots and proofs
+// computed here match the ones committed to the prover journal:
+//   - leaves are the SHA-256 hex digest of each data value
+//   - a parent is the SHA-256 hex digest of the two child hex strings concatenated
+//   - the last node of an odd sized level is promoted unchanged
+type Tree struct {
+	leaves []string
+	nodes  [][]string
+	data   []string
+}
+
+// ProofStep is a single sibling on the path from a leaf to the root. It is
+// encoded as a [hash, is_right] JSON array, the same shape the guest and
+// node.Proof use.
+type ProofStep struct {
+	Hash    string
+	IsRight bool
+}
+
+// Proof is an inclusion proof for a single data value
+type Proof struct {
+	LeafValue string      `json:"leaf_value"`
+	ProofPath []ProofStep `json:"proof_path"`
+}
+
+// Hash returns the SHA-256 hex digest of the data, as the guest computes it
+func Hash(data string) string {
+	sum := sha256.Sum256([]byte(data))
+	return hex.EncodeToString(sum[:])
+}
+
+// New builds a tree from the raw data values (e.g. MerkleTree.Leaves)
+func New(data []string) *Tree {
+	tree := &Tree{
+		leaves: make([]string, 0, len(data)),
+		data:   make([]string, 0, len(data)),
+	}
+	for _, value := range data {
+		tree.leaves = append(tree.leaves, Hash(value))
+		tree.data = append(tree.data, value)
+	}
+
+	current := tree.leaves
+	for len(current) > 1 {
+		next := make([]string, 0, (len(current)+1)/2)
+		for i := 0; i < len(current); i += 2 {
+			if i+1 < len(current) {
+				next = append(next, Hash(current[i]+current[i+1]))
+			} else {
+				next = append(next, current[i])
+			}
+		}
+		tree.nodes = append(tree.nodes, next)
+		current = next
+	}
+
+	return tree
+}
+
+// Root returns the root hash, or an empty string for an empty tree
+func (t *Tree) Root() string {
+	if len(t.nodes) > 0 {
+		return t.nodes[len(t.nodes)-1][0]
+	}
+	if len(t.leaves) > 0 {
+		return t.leaves[0]
+	}
+	return ""
+}
+
+// Leaves returns the leaf hashes in insertion order
+func (t *Tree) Leaves() []string {
+	return t.leaves
+}
+
+// Levels returns every level of the tree, starting with the leaf hashes and
+// ending with the root
+func (t *Tree) Levels() [][]string {
+	levels := [][]string{t.leaves}
+	return append(levels, t.nodes...)
+}
+
+// GenerateProof builds the inclusion proof for a data value. Like the guest,
+// the first leaf matching the value is used and promoted nodes contribute no
+// step to the path.
+func (t *Tree) GenerateProof(value string) (*Proof, error) {
+	leafHash := Hash(value)
+	index := -1
+	for i, leaf := range t.leaves {
+		if leaf == leafHash {
+			index = i
+			break
+		}
+	}
+	if index < 0 {
+		return nil, fmt.Errorf("value %q is not a leaf of the tree", value)
+	}
+
+	path := []ProofStep{}
+	current := t.leaves
+	for _, level := range t.nodes {
+		sibling := index + 1
+		if index%2 == 1 {
+			sibling = index - 1
+		}
+
+		if sibling < len(current) {
+			path = append(path, ProofStep{Hash: current[sibling], IsRight: index%2 == 0})
+		}
+
+		index /= 2
+		current = level
+	}
+
+	return &Proof{
+		LeafValue: value,
+		ProofPath: path,
+	}, nil
+}
+
+// VerifyProof reports whether the proof resolves to this tree's root
+func (t *Tree) VerifyProof(proof Proof) bool {
+	root := t.Root()
+	return root != "" && VerifyProof(root, proof)
+}
+
+// VerifyProof reports whether the proof resolves to the given root
+func VerifyProof(root string, proof Proof) bool {
+	return ComputeRoot(proof) == root
+}
+
+// ComputeRoot folds the proof path over the leaf hash and returns the
+// resulting root
+func ComputeRoot(proof Proof) string {
+	current := Hash(proof.LeafValue)
+	for _, step := range proof.ProofPath {
+		if step.IsRight {
+			current = Hash(current + step.Hash)
+		} else {
+			current = Hash(step.Hash + current)
+		}
+	}
+	return current
+}
+
+func (s ProofStep) MarshalJSON() ([]byte, error) {
+	return json.Marshal([]interface{}{s.Hash, s.IsRight})
+}
+
+func (s *ProofStep) UnmarshalJSON(data []byte) error {
+	var raw []json.RawMessage
+	if err := json.Unmarshal(data, &raw); err != nil {
+		return fmt.Errorf("proof step must be a [hash, is_right] array: %v", err)
+	}
+	if len(raw) != 2 {
+		return fmt.Errorf("proof step must have 2 elements, got %d", len(raw))
+	}
+	if err := json.Unmarshal(raw[0], &s.Hash); err != nil {
+		return fmt.Errorf("invalid proof step hash: %v", err)
+	}
+	if err := json.Unmarshal(raw[1], &s.IsRight); err != nil {
+		return fmt.Errorf("invalid proof step direction: %v", err)
+	}
+	return nil
+}
+
+// StepsFromPath converts a loosely typed [[hash, is_right], ...] path, as
+// decoded into node.Proof, into proof steps
+func StepsFromPath(path [][]interface{}) ([]ProofStep, error) {
+	steps := make([]ProofStep, 0, len(path))
+	for i, element := range path {
+		if len(element) != 2 {
+			return nil, fmt.Errorf("proof step %d must have 2 elements, got %d", i, len(element))
+		}
+		hash, ok := element[0].(string)
+		if !ok {
+			return nil, fmt.Errorf("proof step %d: hash is %T, expected string", i, element[0])
+		}
+		isRight, ok := element[1].(bool)
+		if !ok {
+			return nil, fmt.Errorf("proof step %d: is_right is %T, expected bool", i, element[1])
+		}
+		steps = append(steps, ProofStep{Hash: hash, IsRight: isRight})
+	}
+	return steps, nil
+}
+
+// PathFromSteps converts proof steps back into the loosely typed path used by
+// node.Proof
+func PathFromSteps(steps []ProofStep) [][]interface{} {
+	path := make([][]interface{}, 0, len(steps))
+	for _, step := range steps {
+		path = append(path, []interface{}{step.Hash, step.IsRight})
+	}
+	return path
+}
@@ -0,0 +1,128 @@
+package merkle
+
+import (
+	"encoding/json"
+	"testing"
+)
+
+// Golden vectors produced by the MerkleTree of the guest
+// (risc0-merkle-service/methods/guest/src/main.rs): the root and the
+// serde_json encoding of generate_proof for each requested value.
+var guestVectors = []struct {
+	name   string
+	data   []string
+	root   string
+	proofs map[string]string
+}{
+	{
+		name: "single leaf",
+		data: []string{"a"},
+		root: "ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",
+		proofs: map[string]string{
+			"a": `{"leaf_value":"a","proof_path":[]}`,
+		},
+	},
+	{
+		name: "three leaves",
+		data: []string{"a", "b", "c"},
+		root: "d71dc32fa2cd95be60b32dbb3e63009fa8064407ee19f457c92a09a5ff841a8a",
+		proofs: map[string]string{
+			"a": `{"leaf_value":"a","proof_path":[["3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d",true],["2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6",true]]}`,
+			"b": `{"leaf_value":"b","proof_path":[["ca978112ca1bbdcafac231b39a23dc4da786eff8147c4e72b9807785afee48bb",false],["2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6",true]]}`,
+			"c": `{"leaf_value":"c","proof_path":[["62af5c3cb8da3e4f25061e829ebeea5c7513c54949115b1acc225930a90154da",false]]}`,
+		},
+	},
+	{
+		// Odd sized levels at two heights: 5 -> 3 -> 2 -> 1
+		name: "five leaves",
+		data: []string{"l0", "l1", "l2", "l3", "l4"},
+		root: "cbbd73d6f8379b78f360ca9f287f74d1e90e36d94e76f22d902c03f4493281df",
+		proofs: map[string]string{
+			"l0": `{"leaf_value":"l0","proof_path":[["2804bad6fe94a55f18b2b37e300919a5fd517b95aa81e95db574c0ba069a3740",true],["a31604b0c503032b366019c0c945400c40368bc5914210b064d6a4d60f1af11e",true],["9f102fe3a7d618f9960701e25169aff66169d27e1d7dcf220124a9bf2047436d",true]]}`,
+			"l3": `{"leaf_value":"l3","proof_path":[["8a1cee436cbac1489a1883c9d886fcfc46f302c55ed4106ae31729e4f4eb9041",false],["df3afe7e83cb62cf963f6237544d40e8c5015f1df08f4820a728709b392741cb",false],["9f102fe3a7d618f9960701e25169aff66169d27e1d7dcf220124a9bf2047436d",true]]}`,
+			"l4": `{"leaf_value":"l4","proof_path":[["dd3bacc3456f8cdd162031d90dc1c4e295e9b78acc6f688b6ece84ddb0d2dae9",false]]}`,
+		},
+	},
+	{
+		// The proof of a duplicated value is built from its first leaf
+		name: "duplicate leaves",
+		data: []string{"x", "y", "x", "z"},
+		root: "9365a5cbbcbdddbdacf60fea541cb090fbcf14a1995083a28b2da17ab016450a",
+		proofs: map[string]string{
+			"x": `{"leaf_value":"x","proof_path":[["a1fce4363854ff888cff4b8e7875d600c2682390412a8cf79b37d0b11148b0fa",true],["5bbf360e338631644d61dea4d18fd2603f5a13f48eaf3b15031d4d16675e2cf8",true]]}`,
+			"z": `{"leaf_value":"z","proof_path":[["2d711642b726b04401627ca9fbac32f5c8530fb1903cc4db02258717921a4881",false],["80d888481399c652ab6f09cdee09a96f9f7b665b7758a573275ca76a536e5e5f",false]]}`,
+		},
+	},
+}
+
+func TestGuestVectors(t *testing.T) {
+	for _, vector := range guestVectors {
+		t.Run(vector.name, func(t *testing.T) {
+			tree := New(vector.data)
+			if root := tree.Root(); root != vector.root {
+				t.Fatalf("Root() = %s, want %s", root, vector.root)
+			}
+
+			for value, want := range vector.proofs {
+				proof, err := tree.GenerateProof(value)
+				if err != nil {
+					t.Fatalf("GenerateProof(%q): %v", value, err)
+				}
+				got, err := json.Marshal(proof)
+				if err != nil {
+					t.Fatalf("failed to marshal proof of %q: %v", value, err)
+				}
+				if string(got) != want {
+					t.Errorf("proof of %q = %s, want %s", value, got, want)
+				}
+
+				var decoded Proof
+				if err := json.Unmarshal([]byte(want), &decoded); err != nil {
+					t.Fatalf("failed to unmarshal guest proof of %q: %v", value, err)
+				}
+				if !tree.VerifyProof(decoded) {
+					t.Errorf("guest proof of %q does not verify", value)
+				}
+			}
+		})
+	}
+}
+
+func TestGenerateProofMissingValue(t *testing.T) {
+	// The guest returns no proof for a value that is not a leaf
+	tree := New([]string{"a", "b", "c"})
+	if proof, err := tree.GenerateProof("d"); err == nil {
+		t.Errorf("GenerateProof returned %+v for a value that is not a leaf", proof)
+	}
+}
+
+func TestVerifyProofRejectsTampering(t *testing.T) {
+	tree := New([]string{"l0", "l1", "l2", "l3", "l4"})
+	proof, err := tree.GenerateProof("l3")
+	if err != nil {
+		t.Fatalf("GenerateProof: %v", err)
+	}
+
+	tampered := *proof
+	tampered.LeafValue = "l2"
+	if tree.VerifyProof(tampered) {
+		t.Error("proof verified with another leaf value")
+	}
+
+	tampered = *proof
+	tampered.ProofPath = append([]ProofStep(nil), proof.ProofPath...)
+	tampered.ProofPath[0].IsRight = !tampered.ProofPath[0].IsRight
+	if tree.VerifyProof(tampered) {
+		t.Error("proof verified with a flipped direction")
+	}
+}
+
+func TestEmptyTree(t *testing.T) {
+	tree := New(nil)
+	if root := tree.Root(); root != "" {
+		t.Errorf("Root() = %q, want empty", root)
+	}
+	if tree.VerifyProof(Proof{LeafValue: "a", ProofPath: []ProofStep{}}) {
+		t.Error("proof verified against an empty tree")
+	}
+}
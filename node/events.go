@@ -0,0 +1,142 @@
+package node
+
+import (
+	"context"
+	"sync"
+	"sync/atomic"
+	"time"
+
+	"github.com/Layer-Edge/light-node/clients"
+)
+
+const (
+	eventRetryMinBackoff = 5 * time.Second
+	eventRetryMaxBackoff = time.Minute
+)
+
+// TreeQueue passes the trees changed on chain to one worker. Changes pushed
+// while the worker is busy are merged, so a burst of events triggers a single
+// run.
+type TreeQueue struct {
+	mu      sync.Mutex
+	pending []string
+	queued  map[string]bool
+	ready   chan struct{}
+	live    atomic.Bool
+}
+
+func NewTreeQueue() *TreeQueue {
+	return &TreeQueue{
+		queued: map[string]bool{},
+		ready:  make(chan struct{}, 1),
+	}
+}
+
+// Push queues the changed trees and wakes the worker. An empty list only wakes
+// it, for changes that did not name a tree.
+func (q *TreeQueue) Push(treeIds []string) {
+	q.mu.Lock()
+	for _, treeId := range treeIds {
+		if !q.queued[treeId] {
+			q.queued[treeId] = true
+			q.pending = append(q.pending, treeId)
+		}
+	}
+	q.mu.Unlock()
+
+	select {
+	case q.ready <- struct{}{}:
+	default:
+	}
+}
+
+// Ready receives a value when trees were pushed since the last Take
+func (q *TreeQueue) Ready() <-chan struct{} {
+	return q.ready
+}
+
+// Take returns and clears the queued trees, oldest first
+func (q *TreeQueue) Take() []string {
+	q.mu.Lock()
+	defer q.mu.Unlock()
+
+	// The taken trees no longer need a wake up
+	select {
+	case <-q.ready:
+	default:
+	}
+
+	treeIds := q.pending
+	q.pending = nil
+	q.queued = map[string]bool{}
+	return treeIds
+}
+
+// Live reports whether changes are currently pushed from a live event
+// subscription. While it is not, the worker has to poll.
+func (q *TreeQueue) Live() bool {
+	return q.live.Load()
+}
+
+// WatchContractEvents subscribes to the executions of the contract through
+// the CometBFT RPC node at rpcURL and pushes the trees they change to every
+// queue, until ctx is cancelled. The changed trees are dropped from the tree
+// cache of cosmosQueryClient. When the subscription drops, the queues are
+// marked not live so workers fall back to polling, and it is retried with
+// exponential backoff.
+func WatchContractEvents(ctx context.Context, rpcURL, contractAddr string, cosmosQueryClient *clients.CosmosQueryClient, queues []*TreeQueue) {
+	setLive := func(live bool) {
+		for _, q := range queues {
+			q.live.Store(live)
+		}
+		if live {
+			eventSubscriptionUp.Set(1)
+		} else {
+			eventSubscriptionUp.Set(0)
+		}
+	}
+	defer setLive(false)
+
+	backoff := eventRetryMinBackoff
+	for {
+		sub, err := clients.SubscribeContractEvents(ctx, rpcURL, contractAddr)
+		if err != nil {
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("failed to subscribe to contract events, polling", "rpc_url", rpcURL, "retry_in", backoff, "error", err)
+		} else {
+			logger.Info("subscribed to contract events", "rpc_url", rpcURL)
+			backoff = eventRetryMinBackoff
+			setLive(true)
+			// Catch up on the changes missed while the subscription was down
+			cosmosQueryClient.InvalidateTrees()
+			for _, q := range queues {
+				q.Push(nil)
+			}
+
+			for treeIds := range sub.Changes() {
+				logger.Debug("contract event received", "tree_ids", treeIds)
+				contractEvents.Inc()
+				// An event naming no tree may have changed any of them
+				cosmosQueryClient.InvalidateTrees(treeIds...)
+				for _, q := range queues {
+					q.Push(treeIds)
+				}
+			}
+
+			setLive(false)
+			if ctx.Err() != nil {
+				return
+			}
+			logger.Warn("contract event subscription dropped, polling", "retry_in", backoff, "error", sub.Err())
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-time.After(backoff):
+		}
+		backoff = min(backoff*2, eventRetryMaxBackoff)
+	}
+}
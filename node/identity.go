@@ -0,0 +1,77 @@
+package node
+
+import (
+	"crypto/ecdsa"
+	"encoding/hex"
+	"fmt"
+
+	"github.com/Layer-Edge/light-node/utils"
+	"github.com/ethereum/go-ethereum/crypto"
+	"github.com/ethereum/go-ethereum/crypto/secp256k1"
+)
+
+// Signer signs submission messages on behalf of a single wallet
+type Signer interface {
+	// Address returns the checksummed wallet address the signatures recover to
+	Address() string
+	// SignMessage signs the message with the wallet's private key
+	SignMessage(message string) (string, error)
+}
+
+// Identity binds a wallet address to the private key that produced it, so a
+// worker always submits and signs with the same key
+type Identity struct {
+	privateKey *ecdsa.PrivateKey
+	address    string
+}
+
+// NewIdentity creates an identity from a hex encoded private key
+func NewIdentity(privKey string) (*Identity, error) {
+	privateKey, err := crypto.HexToECDSA(privKey)
+	if err != nil {
+		return nil, fmt.Errorf("invalid private key: %v", err)
+	}
+
+	return &Identity{
+		privateKey: privateKey,
+		address:    crypto.PubkeyToAddress(privateKey.PublicKey).Hex(),
+	}, nil
+}
+
+// LoadIdentities creates an identity for every valid private key, skipping
+// (and logging) keys that cannot be parsed
+func LoadIdentities(privKeys []string) ([]*Identity, error) {
+	var identities []*Identity
+	for i, privKey := range privKeys {
+		identity, err := NewIdentity(privKey)
+		if err != nil {
+			logger.Warn("skipping invalid private key", "key", i+1, "error", err)
+			continue
+		}
+		identities = append(identities, identity)
+	}
+
+	if len(identities) == 0 {
+		return nil, fmt.Errorf("no valid private keys loaded")
+	}
+
+	return identities, nil
+}
+
+func (id *Identity) Address() string {
+	return id.address
+}
+
+// CompressedPublicKey returns the hex encoded compressed public key
+func (id *Identity) CompressedPublicKey() string {
+	publicKey := id.privateKey.PublicKey
+	return hex.EncodeToString(secp256k1.CompressPubkey(publicKey.X, publicKey.Y))
+}
+
+func (id *Identity) SignMessage(message string) (string, error) {
+	signature, err := utils.SignMessageWithKey(message, id.privateKey)
+	if err != nil {
+		return "", err
+	}
+	return *signature, nil
+}
@@ -0,0 +1,91 @@
+package node
+
+import (
+	"strconv"
+	"strings"
+	"testing"
+
+	"github.com/Layer-Edge/light-node/utils"
+	"github.com/ethereum/go-ethereum/common/hexutil"
+	"github.com/ethereum/go-ethereum/crypto"
+)
+
+const (
+	testPrivateKey = "4c0883a69102937d6231471b5dbb6204fe5129617082792ae468d01a3f362318"
+	testAddress    = "0x2c7536E3605D9C16a7a3D7b1898e529396a65c23"
+)
+
+func TestIdentityAddress(t *testing.T) {
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	if identity.Address() != testAddress {
+		t.Errorf("Address() = %s, want %s", identity.Address(), testAddress)
+	}
+}
+
+func TestIdentitySignatureRecoversToAddress(t *testing.T) {
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+
+	message := "Submitting proof verification by " + identity.Address() + " of leaf at 1700000000000"
+	signature, err := identity.SignMessage(message)
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+
+	if err := utils.VerifyMessage(signature, message, identity.Address()); err != nil {
+		t.Errorf("VerifyMessage: %v", err)
+	}
+
+	// Recover independently of utils to check the signature format itself
+	sig, err := hexutil.Decode(signature)
+	if err != nil {
+		t.Fatalf("signature is not hex: %v", err)
+	}
+	if len(sig) != 65 || (sig[64] != 27 && sig[64] != 28) {
+		t.Fatalf("signature is not a 65 byte Ethereum signature: %x", sig)
+	}
+	sig[64] -= 27
+	hash := crypto.Keccak256([]byte("\x19Ethereum Signed Message:\n" + strconv.Itoa(len(message)) + message))
+	publicKey, err := crypto.SigToPub(hash, sig)
+	if err != nil {
+		t.Fatalf("SigToPub: %v", err)
+	}
+	if recovered := crypto.PubkeyToAddress(*publicKey).Hex(); recovered != identity.Address() {
+		t.Errorf("signature recovers to %s, want %s", recovered, identity.Address())
+	}
+}
+
+func TestVerifyMessageAddressMismatch(t *testing.T) {
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	other, err := crypto.GenerateKey()
+	if err != nil {
+		t.Fatalf("GenerateKey: %v", err)
+	}
+	otherAddress := crypto.PubkeyToAddress(other.PublicKey).Hex()
+
+	signature, err := identity.SignMessage("message")
+	if err != nil {
+		t.Fatalf("SignMessage: %v", err)
+	}
+
+	err = utils.VerifyMessage(signature, "message", otherAddress)
+	if err == nil {
+		t.Fatal("VerifyMessage accepted a signature for another address")
+	}
+	if !strings.Contains(err.Error(), "recovers to "+identity.Address()) {
+		t.Errorf("error %q does not name the recovered address", err)
+	}
+
+	// A different message recovers to a different address as well
+	if err := utils.VerifyMessage(signature, "other message", identity.Address()); err == nil {
+		t.Error("VerifyMessage accepted a signature of another message")
+	}
+}
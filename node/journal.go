@@ -0,0 +1,267 @@
+package node
+
+import (
+	"encoding/binary"
+	"encoding/hex"
+	"fmt"
+	"strings"
+
+	"github.com/Layer-Edge/light-node/merkle"
+)
+
+// Journal is the guest Output struct committed to the RISC Zero journal.
+// ZKProverResponse.Receipt carries the hex encoded journal bytes.
+type Journal struct {
+	Root     *string
+	Proof    *Proof
+	Verified *bool
+	Receipt  *string
+}
+
+// DecodeJournal decodes a hex encoded journal produced by the guest. The
+// journal uses the risc0 serde encoding: every value is a sequence of
+// little-endian u32 words, options are prefixed with a 0/1 tag word, strings
+// and vectors with their length, and string bytes are zero padded to a word.
+func DecodeJournal(journalHex string) (*Journal, error) {
+	data, err := hex.DecodeString(strings.TrimPrefix(journalHex, "0x"))
+	if err != nil {
+		return nil, fmt.Errorf("journal is not valid hex: %v", err)
+	}
+	if len(data)%4 != 0 {
+		return nil, fmt.Errorf("journal length %d is not a multiple of 4", len(data))
+	}
+
+	r := &journalReader{data: data}
+	journal := &Journal{}
+
+	if journal.Root, err = r.optionalString(); err != nil {
+		return nil, fmt.Errorf("failed to decode journal root: %v", err)
+	}
+	if journal.Proof, err = r.optionalProof(); err != nil {
+		return nil, fmt.Errorf("failed to decode journal proof: %v", err)
+	}
+	if journal.Verified, err = r.optionalBool(); err != nil {
+		return nil, fmt.Errorf("failed to decode journal verified flag: %v", err)
+	}
+	if journal.Receipt, err = r.optionalString(); err != nil {
+		return nil, fmt.Errorf("failed to decode journal receipt: %v", err)
+	}
+	if r.remaining() != 0 {
+		return nil, fmt.Errorf("journal has %d unexpected trailing bytes", r.remaining())
+	}
+
+	return journal, nil
+}
+
+// CheckVerified confirms the journal attests a successful verification of a
+// tree whose root equals the expected (on-chain) root
+func (j *Journal) CheckVerified(expectedRoot string) error {
+	if j.Verified == nil || !*j.Verified {
+		return fmt.Errorf("journal does not attest a verified proof")
+	}
+	if j.Root == nil {
+		return fmt.Errorf("journal does not commit a root")
+	}
+	if !strings.EqualFold(*j.Root, expectedRoot) {
+		return fmt.Errorf("journal root %s does not match on-chain root %s", *j.Root, expectedRoot)
+	}
+	return nil
+}
+
+// EncodeJournal encodes the journal with the same risc0 serde layout the
+// guest commits, the inverse of DecodeJournal
+func EncodeJournal(journal Journal) (string, error) {
+	w := &journalWriter{}
+
+	w.optionalString(journal.Root)
+	if err := w.optionalProof(journal.Proof); err != nil {
+		return "", err
+	}
+	w.optionalBool(journal.Verified)
+	w.optionalString(journal.Receipt)
+
+	return hex.EncodeToString(w.data), nil
+}
+
+type journalReader struct {
+	data   []byte
+	offset int
+}
+
+func (r *journalReader) remaining() int {
+	return len(r.data) - r.offset
+}
+
+func (r *journalReader) word() (uint32, error) {
+	if r.remaining() < 4 {
+		return 0, fmt.Errorf("unexpected end of journal at byte %d", r.offset)
+	}
+	value := binary.LittleEndian.Uint32(r.data[r.offset:])
+	r.offset += 4
+	return value, nil
+}
+
+func (r *journalReader) present() (bool, error) {
+	tag, err := r.word()
+	if err != nil {
+		return false, err
+	}
+	switch tag {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid option tag %d", tag)
+	}
+}
+
+func (r *journalReader) bool() (bool, error) {
+	value, err := r.word()
+	if err != nil {
+		return false, err
+	}
+	switch value {
+	case 0:
+		return false, nil
+	case 1:
+		return true, nil
+	default:
+		return false, fmt.Errorf("invalid bool value %d", value)
+	}
+}
+
+func (r *journalReader) string() (string, error) {
+	length, err := r.word()
+	if err != nil {
+		return "", err
+	}
+	padded := (int(length) + 3) &^ 3
+	if padded < int(length) || r.remaining() < padded {
+		return "", fmt.Errorf("string of length %d exceeds journal", length)
+	}
+	value := string(r.data[r.offset : r.offset+int(length)])
+	r.offset += padded
+	return value, nil
+}
+
+func (r *journalReader) optionalString() (*string, error) {
+	ok, err := r.present()
+	if err != nil || !ok {
+		return nil, err
+	}
+	value, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (r *journalReader) optionalBool() (*bool, error) {
+	ok, err := r.present()
+	if err != nil || !ok {
+		return nil, err
+	}
+	value, err := r.bool()
+	if err != nil {
+		return nil, err
+	}
+	return &value, nil
+}
+
+func (r *journalReader) optionalProof() (*Proof, error) {
+	ok, err := r.present()
+	if err != nil || !ok {
+		return nil, err
+	}
+
+	leafValue, err := r.string()
+	if err != nil {
+		return nil, err
+	}
+	steps, err := r.word()
+	if err != nil {
+		return nil, err
+	}
+	// Each step takes at least two words, reject lengths the journal cannot hold
+	if int(steps) > r.remaining()/8 {
+		return nil, fmt.Errorf("proof path of length %d exceeds journal", steps)
+	}
+
+	path := make([][]interface{}, 0, steps)
+	for i := uint32(0); i < steps; i++ {
+		hash, err := r.string()
+		if err != nil {
+			return nil, err
+		}
+		isRight, err := r.bool()
+		if err != nil {
+			return nil, err
+		}
+		path = append(path, []interface{}{hash, isRight})
+	}
+
+	return &Proof{LeafValue: leafValue, ProofPath: path}, nil
+}
+
+type journalWriter struct {
+	data []byte
+}
+
+func (w *journalWriter) word(value uint32) {
+	w.data = binary.LittleEndian.AppendUint32(w.data, value)
+}
+
+func (w *journalWriter) bool(value bool) {
+	if value {
+		w.word(1)
+	} else {
+		w.word(0)
+	}
+}
+
+func (w *journalWriter) string(value string) {
+	w.word(uint32(len(value)))
+	w.data = append(w.data, value...)
+	for len(w.data)%4 != 0 {
+		w.data = append(w.data, 0)
+	}
+}
+
+func (w *journalWriter) optionalString(value *string) {
+	if value == nil {
+		w.word(0)
+		return
+	}
+	w.word(1)
+	w.string(*value)
+}
+
+func (w *journalWriter) optionalBool(value *bool) {
+	if value == nil {
+		w.word(0)
+		return
+	}
+	w.word(1)
+	w.bool(*value)
+}
+
+func (w *journalWriter) optionalProof(proof *Proof) error {
+	if proof == nil {
+		w.word(0)
+		return nil
+	}
+	steps, err := merkle.StepsFromPath(proof.ProofPath)
+	if err != nil {
+		return err
+	}
+
+	w.word(1)
+	w.string(proof.LeafValue)
+	w.word(uint32(len(steps)))
+	for _, step := range steps {
+		w.string(step.Hash)
+		w.bool(step.IsRight)
+	}
+	return nil
+}
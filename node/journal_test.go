@@ -0,0 +1,155 @@
+package node
+
+import (
+	"reflect"
+	"strings"
+	"testing"
+)
+
+// Journals committed by the guest for the tree of leaves a, b and c, in the
+// risc0 serde layout: option tags, string lengths and bools are little-endian
+// u32 words, string bytes are zero padded to a word.
+const (
+	testRoot = "d71dc32fa2cd95be60b32dbb3e63009fa8064407ee19f457c92a09a5ff841a8a"
+
+	// Output{root: Some(root), proof: None, verified: Some(true), receipt: None}
+	verifyJournal = "01000000" + "40000000" + "64373164633332666132636439356265363062333264626233653633303039666138303634343037656531396634353763393261303961356666383431613861" +
+		"00000000" +
+		"01000000" + "01000000" +
+		"00000000"
+
+	// Output{root: Some(root), proof: Some(proof of a), verified: None, receipt: None}
+	proveJournal = "01000000" + "40000000" + "64373164633332666132636439356265363062333264626233653633303039666138303634343037656531396634353763393261303961356666383431613861" +
+		"01000000" + "01000000" + "61000000" + "02000000" +
+		"40000000" + "33653233653831363030333935393461333338393466363536346531623133343862626437613030383864343263346163623733656561656435396330303964" + "01000000" +
+		"40000000" + "32653764326330336139353037616532363565636635623533353638383561353333393361323032396432343133393439393732363561316132356165666336" + "01000000" +
+		"00000000" +
+		"00000000"
+)
+
+func ptr[T any](value T) *T {
+	return &value
+}
+
+func TestDecodeGuestJournal(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal string
+		want    *Journal
+	}{
+		{"verify", verifyJournal, &Journal{Root: ptr(testRoot), Verified: ptr(true)}},
+		{"verify with 0x prefix", "0x" + verifyJournal, &Journal{Root: ptr(testRoot), Verified: ptr(true)}},
+		{
+			"prove",
+			proveJournal,
+			&Journal{
+				Root: ptr(testRoot),
+				Proof: &Proof{LeafValue: "a", ProofPath: [][]interface{}{
+					{"3e23e8160039594a33894f6564e1b1348bbd7a0088d42c4acb73eeaed59c009d", true},
+					{"2e7d2c03a9507ae265ecf5b5356885a53393a2029d241394997265a1a25aefc6", true},
+				}},
+			},
+		},
+		{"empty output", "00000000" + "00000000" + "00000000" + "00000000", &Journal{}},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal, err := DecodeJournal(tt.journal)
+			if err != nil {
+				t.Fatalf("DecodeJournal: %v", err)
+			}
+			if !reflect.DeepEqual(journal, tt.want) {
+				t.Errorf("DecodeJournal = %+v, want %+v", journal, tt.want)
+			}
+		})
+	}
+}
+
+func TestJournalRoundTrip(t *testing.T) {
+	journals := []Journal{
+		{},
+		{Root: ptr(testRoot), Verified: ptr(false)},
+		{Root: ptr(""), Receipt: ptr("receipt of odd length")},
+		{
+			Root:     ptr(testRoot),
+			Proof:    &Proof{LeafValue: "leaf", ProofPath: [][]interface{}{{"ab", false}, {"abc", true}}},
+			Verified: ptr(true),
+			Receipt:  ptr("r"),
+		},
+	}
+	for _, journal := range journals {
+		encoded, err := EncodeJournal(journal)
+		if err != nil {
+			t.Fatalf("EncodeJournal(%+v): %v", journal, err)
+		}
+		decoded, err := DecodeJournal(encoded)
+		if err != nil {
+			t.Fatalf("DecodeJournal(%s): %v", encoded, err)
+		}
+		if !reflect.DeepEqual(*decoded, journal) {
+			t.Errorf("round trip = %+v, want %+v", *decoded, journal)
+		}
+	}
+
+	// The encoder produces the guest layout
+	encoded, err := EncodeJournal(Journal{Root: ptr(testRoot), Verified: ptr(true)})
+	if err != nil || encoded != verifyJournal {
+		t.Errorf("EncodeJournal = %s, %v, want %s", encoded, err, verifyJournal)
+	}
+}
+
+func TestDecodeJournalInvalid(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal string
+		wantErr string
+	}{
+		{"not hex", "zz000000", "not valid hex"},
+		{"partial word", verifyJournal + "00", "not a multiple of 4"},
+		{"empty", "", "unexpected end of journal"},
+		{"truncated", verifyJournal[:len(verifyJournal)-8], "unexpected end of journal"},
+		{"truncated string", proveJournal[:40], "exceeds journal"},
+		{"bad option tag", "02000000" + verifyJournal[8:], "invalid option tag 2"},
+		{"bad bool", strings.Replace(verifyJournal, "0100000001000000", "0100000002000000", 1), "invalid bool value 2"},
+		{"trailing bytes", verifyJournal + "00000000", "4 unexpected trailing bytes"},
+		{"oversized proof path", "00000000" + "01000000" + "01000000" + "61000000" + "ffffff7f", "exceeds journal"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			journal, err := DecodeJournal(tt.journal)
+			if err == nil {
+				t.Fatalf("DecodeJournal = %+v, want an error", journal)
+			}
+			if !strings.Contains(err.Error(), tt.wantErr) {
+				t.Errorf("DecodeJournal error = %v, want %q", err, tt.wantErr)
+			}
+		})
+	}
+}
+
+func TestCheckVerified(t *testing.T) {
+	tests := []struct {
+		name    string
+		journal Journal
+		root    string
+		wantErr string // Empty when the journal is accepted
+	}{
+		{name: "verified", journal: Journal{Root: ptr(testRoot), Verified: ptr(true)}, root: testRoot},
+		{name: "root case", journal: Journal{Root: ptr(testRoot), Verified: ptr(true)}, root: strings.ToUpper(testRoot)},
+		{name: "not verified", journal: Journal{Root: ptr(testRoot), Verified: ptr(false)}, root: testRoot, wantErr: "does not attest"},
+		{name: "no verified flag", journal: Journal{Root: ptr(testRoot)}, root: testRoot, wantErr: "does not attest"},
+		{name: "no root", journal: Journal{Verified: ptr(true)}, root: testRoot, wantErr: "does not commit a root"},
+		{name: "root mismatch", journal: Journal{Root: ptr(testRoot), Verified: ptr(true)}, root: "00" + testRoot[2:], wantErr: "does not match on-chain root"},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			err := tt.journal.CheckVerified(tt.root)
+			switch {
+			case tt.wantErr == "" && err != nil:
+				t.Errorf("CheckVerified: %v", err)
+			case tt.wantErr != "" && (err == nil || !strings.Contains(err.Error(), tt.wantErr)):
+				t.Errorf("CheckVerified = %v, want an error containing %q", err, tt.wantErr)
+			}
+		})
+	}
+}
@@ -0,0 +1,190 @@
+package node
+
+import (
+	"bufio"
+	"encoding/json"
+	"fmt"
+	"os"
+	"strings"
+	"sync"
+	"time"
+)
+
+// SubmissionRecord is a single accepted proof submission
+type SubmissionRecord struct {
+	WalletAddress string                 `json:"wallet_address"`
+	TreeId        string                 `json:"tree_id"`
+	Root          string                 `json:"root"`
+	Height        int64                  `json:"height,omitempty"` // Block height the tree was read at
+	Leaf          string                 `json:"leaf"`
+	ProofHash     string                 `json:"proof_hash"`
+	Receipt       string                 `json:"receipt"`
+	Timestamp     time.Time              `json:"timestamp"`
+	Response      map[string]interface{} `json:"response"`
+}
+
+type submissionKey struct {
+	wallet string
+	treeId string
+	root   string
+	leaf   string
+}
+
+func (r SubmissionRecord) key() submissionKey {
+	return submissionKey{
+		wallet: strings.ToLower(r.WalletAddress),
+		treeId: r.TreeId,
+		root:   strings.ToLower(r.Root),
+		leaf:   r.Leaf,
+	}
+}
+
+// Ledger is an append-only log of submissions, stored as one JSON record per
+// line. A leaf counts as submitted per wallet, tree and root, so every wallet
+// can still submit it once and a new root makes every leaf eligible again.
+type Ledger struct {
+	mu      sync.Mutex
+	file    *os.File
+	records []SubmissionRecord
+	index   map[submissionKey]struct{}
+}
+
+// OpenLedger loads the ledger stored at path, creating the file if needed.
+// An empty path keeps the ledger in memory only.
+func OpenLedger(path string) (*Ledger, error) {
+	ledger := &Ledger{index: make(map[submissionKey]struct{})}
+	if path == "" {
+		return ledger, nil
+	}
+
+	records, err := ReadLedger(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, err
+	}
+	for _, record := range records {
+		ledger.add(record)
+	}
+
+	file, err := os.OpenFile(path, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+	if err != nil {
+		return nil, fmt.Errorf("failed to open ledger %s: %v", path, err)
+	}
+	ledger.file = file
+
+	return ledger, nil
+}
+
+// ReadLedger reads every record of the ledger at path without opening it for
+// writing. A truncated trailing record, left by a crash, is skipped.
+func ReadLedger(path string) ([]SubmissionRecord, error) {
+	file, err := os.Open(path)
+	if err != nil {
+		return nil, err
+	}
+	defer file.Close()
+
+	var records []SubmissionRecord
+	scanner := bufio.NewScanner(file)
+	scanner.Buffer(make([]byte, 64*1024), 16*1024*1024)
+	line := 0
+	for scanner.Scan() {
+		line++
+		text := strings.TrimSpace(scanner.Text())
+		if text == "" {
+			continue
+		}
+
+		var record SubmissionRecord
+		if err := json.Unmarshal([]byte(text), &record); err != nil {
+			logger.Warn("skipping invalid ledger record", "file", path, "line", line, "error", err)
+			continue
+		}
+		records = append(records, record)
+	}
+
+	if err := scanner.Err(); err != nil {
+		return nil, fmt.Errorf("error reading ledger %s: %v", path, err)
+	}
+
+	return records, nil
+}
+
+func (l *Ledger) add(record SubmissionRecord) {
+	l.records = append(l.records, record)
+	l.index[record.key()] = struct{}{}
+}
+
+// Append records a submission and writes it to the ledger file
+func (l *Ledger) Append(record SubmissionRecord) error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	l.add(record)
+	if l.file == nil {
+		return nil
+	}
+
+	data, err := json.Marshal(record)
+	if err != nil {
+		return fmt.Errorf("failed to marshal ledger record: %v", err)
+	}
+	if _, err := l.file.Write(append(data, '\n')); err != nil {
+		return fmt.Errorf("failed to write ledger record: %v", err)
+	}
+	return nil
+}
+
+// HasSubmitted reports whether the wallet already submitted the leaf of the
+// tree at the given root
+func (l *Ledger) HasSubmitted(walletAddress, treeId, root, leaf string) bool {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	_, exists := l.index[SubmissionRecord{WalletAddress: walletAddress, TreeId: treeId, Root: root, Leaf: leaf}.key()]
+	return exists
+}
+
+// UnsubmittedLeaves returns the leaves the wallet has not submitted yet for
+// the tree at the given root
+func (l *Ledger) UnsubmittedLeaves(walletAddress, treeId, root string, leaves []string) []string {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	var remaining []string
+	for _, leaf := range leaves {
+		key := SubmissionRecord{WalletAddress: walletAddress, TreeId: treeId, Root: root, Leaf: leaf}.key()
+		if _, exists := l.index[key]; !exists {
+			remaining = append(remaining, leaf)
+		}
+	}
+	return remaining
+}
+
+// Records returns a copy of every record, oldest first
+func (l *Ledger) Records() []SubmissionRecord {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	records := make([]SubmissionRecord, len(l.records))
+	copy(records, l.records)
+	return records
+}
+
+func (l *Ledger) Close() error {
+	l.mu.Lock()
+	defer l.mu.Unlock()
+
+	if l.file == nil {
+		return nil
+	}
+	err := l.file.Close()
+	l.file = nil
+	return err
+}
+
+var ledger, _ = OpenLedger("")
+
+// SetLedger replaces the ledger used to record and deduplicate submissions
+func SetLedger(l *Ledger) {
+	ledger = l
+}
@@ -0,0 +1,10 @@
+package node
+
+import "log/slog"
+
+var logger = slog.Default()
+
+// SetLogger replaces the logger used by the node package
+func SetLogger(l *slog.Logger) {
+	logger = l
+}
@@ -0,0 +1,100 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Layer-Edge/light-node/clients"
+	"github.com/prometheus/client_golang/prometheus"
+	"github.com/prometheus/client_golang/prometheus/promauto"
+	"github.com/prometheus/client_golang/prometheus/promhttp"
+)
+
+var (
+	treesListed = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "light_node_trees_listed_total",
+		Help: "Number of tree ids listed from the contract.",
+	})
+	treesSkippedSleeping = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "light_node_trees_skipped_sleeping_total",
+		Help: "Number of trees skipped because they were sleeping.",
+	})
+	treeOutcomes = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "light_node_tree_outcomes_total",
+		Help: "Number of tree verification attempts by outcome.",
+	}, []string{"outcome"})
+	proveDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "light_node_prove_duration_seconds",
+		Help:    "Time taken to generate a proof.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"result"})
+	verifyDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "light_node_verify_duration_seconds",
+		Help:    "Time taken to verify a proof and obtain its receipt.",
+		Buckets: prometheus.ExponentialBuckets(0.5, 2, 12),
+	}, []string{"result"})
+	submissions = promauto.NewCounterVec(prometheus.CounterOpts{
+		Name: "light_node_submissions_total",
+		Help: "Number of proof submissions to the points API by HTTP status code (\"error\" when no response was received).",
+	}, []string{"status"})
+	contractEvents = promauto.NewCounter(prometheus.CounterOpts{
+		Name: "light_node_contract_events_total",
+		Help: "Number of contract executions received from the event subscription.",
+	})
+	eventSubscriptionUp = promauto.NewGauge(prometheus.GaugeOpts{
+		Name: "light_node_event_subscription_up",
+		Help: "Whether the contract event subscription is live (1) or the workers poll (0).",
+	})
+	workerLoopDuration = promauto.NewHistogramVec(prometheus.HistogramOpts{
+		Name:    "light_node_worker_loop_duration_seconds",
+		Help:    "Time taken by one CollectSampleAndVerify run, per worker.",
+		Buckets: prometheus.ExponentialBuckets(0.1, 2, 14),
+	}, []string{"worker"})
+)
+
+func resultLabel(err error) string {
+	if err != nil {
+		return "error"
+	}
+	return "success"
+}
+
+// submissionStatusLabel returns the HTTP status code of a submission
+func submissionStatusLabel(err error) string {
+	if err == nil {
+		return strconv.Itoa(http.StatusOK)
+	}
+	var httpErr *clients.HTTPError
+	if errors.As(err, &httpErr) {
+		return strconv.Itoa(httpErr.StatusCode)
+	}
+	return "error"
+}
+
+func observeWorkerLoop(workerID int, start time.Time) {
+	workerLoopDuration.WithLabelValues(strconv.Itoa(workerID)).Observe(time.Since(start).Seconds())
+}
+
+// ServeMetrics exposes the Prometheus metrics on addr at /metrics until ctx
+// is cancelled
+func ServeMetrics(ctx context.Context, addr string) error {
+	mux := http.NewServeMux()
+	mux.Handle("/metrics", promhttp.Handler())
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("serving metrics", "addr", "http://"+addr+"/metrics")
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
@@ -0,0 +1,254 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"os"
+	"sync"
+	"time"
+
+	"github.com/Layer-Edge/light-node/clients"
+	"github.com/Layer-Edge/light-node/config"
+)
+
+const (
+	outboxRetryInterval = 15 * time.Second
+	outboxBaseBackoff   = 30 * time.Second
+	outboxMaxBackoff    = 30 * time.Minute
+	outboxMaxAttempts   = 20
+)
+
+// OutboxEntry is a verified proof whose submission to the points API failed
+// with a retryable error
+type OutboxEntry struct {
+	Request     SubmitProofRequest `json:"request"`
+	TreeId      string             `json:"tree_id"`
+	Root        string             `json:"root"`
+	Height      int64              `json:"height,omitempty"`
+	Proxy       string             `json:"proxy"`
+	Attempts    int                `json:"attempts"`
+	NextAttempt time.Time          `json:"next_attempt"`
+	LastError   string             `json:"last_error"`
+	CreatedAt   time.Time          `json:"created_at"`
+}
+
+func (e OutboxEntry) key() submissionKey {
+	return SubmissionRecord{
+		WalletAddress: e.Request.WalletAddress,
+		TreeId:        e.TreeId,
+		Root:          e.Root,
+		Leaf:          e.Request.Proof,
+	}.key()
+}
+
+// Outbox holds failed submissions and retries them with exponential backoff,
+// so a points API outage does not throw away proving work. Entries are
+// written to a JSON file after every change.
+type Outbox struct {
+	mu      sync.Mutex
+	path    string
+	entries []OutboxEntry
+}
+
+// OpenOutbox loads the outbox stored at path. An empty path keeps the outbox
+// in memory only.
+func OpenOutbox(path string) (*Outbox, error) {
+	outbox := &Outbox{path: path}
+	if path == "" {
+		return outbox, nil
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read outbox %s: %v", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &outbox.entries); err != nil {
+			return nil, fmt.Errorf("failed to parse outbox %s: %v", path, err)
+		}
+	}
+
+	return outbox, nil
+}
+
+func (o *Outbox) save() error {
+	if o.path == "" {
+		return nil
+	}
+	entries := o.entries
+	if entries == nil {
+		entries = []OutboxEntry{}
+	}
+	return writeJSONFile(o.path, entries)
+}
+
+// Enqueue stores a failed submission for a later retry
+func (o *Outbox) Enqueue(entry OutboxEntry, submitErr error) error {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	now := clock()
+	entry.CreatedAt = now
+	entry.Attempts = 1
+	entry.NextAttempt = now.Add(outboxBackoff(entry.Attempts))
+	if submitErr != nil {
+		entry.LastError = submitErr.Error()
+	}
+
+	o.entries = append(o.entries, entry)
+	return o.save()
+}
+
+// IsPending reports whether the leaf is waiting in the outbox for the wallet,
+// tree and root
+func (o *Outbox) IsPending(walletAddress, treeId, root, leaf string) bool {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	key := SubmissionRecord{WalletAddress: walletAddress, TreeId: treeId, Root: root, Leaf: leaf}.key()
+	for _, entry := range o.entries {
+		if entry.key() == key {
+			return true
+		}
+	}
+	return false
+}
+
+// Entries returns a copy of the pending entries, oldest first
+func (o *Outbox) Entries() []OutboxEntry {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	entries := make([]OutboxEntry, len(o.entries))
+	copy(entries, o.entries)
+	return entries
+}
+
+// Run retries due entries with the current configuration of store until ctx
+// is cancelled. Each retry is signed again by the identity of the entry's
+// wallet.
+func (o *Outbox) Run(ctx context.Context, store *config.Store, identities []*Identity) {
+	signers := make(map[string]Signer, len(identities))
+	for _, identity := range identities {
+		signers[identity.Address()] = identity
+	}
+
+	ticker := time.NewTicker(outboxRetryInterval)
+	defer ticker.Stop()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+			o.retryDue(ctx, store.Current(), signers)
+		}
+	}
+}
+
+// retryDue resubmits every entry whose backoff has elapsed, signed by the
+// signer of its wallet. Requests are sent without holding the lock so workers
+// can keep enqueueing.
+func (o *Outbox) retryDue(ctx context.Context, cfg *config.Config, signers map[string]Signer) {
+	o.mu.Lock()
+	now := clock()
+	var due []OutboxEntry
+	for _, entry := range o.entries {
+		if !now.Before(entry.NextAttempt) {
+			due = append(due, entry)
+		}
+	}
+	o.mu.Unlock()
+
+	for _, entry := range due {
+		if ctx.Err() != nil {
+			return
+		}
+
+		signer, ok := signers[entry.Request.WalletAddress]
+		if !ok {
+			logger.Warn("dropping queued proof, no private key for the wallet", "phase", "outbox", "tree_id", entry.TreeId,
+				"wallet", entry.Request.WalletAddress)
+			o.finish(entry, nil)
+			continue
+		}
+		if err := signSubmission(logger, signer, &entry.Request); err != nil {
+			logger.Error("failed to sign queued proof", "phase", "outbox", "tree_id", entry.TreeId,
+				"wallet", entry.Request.WalletAddress, "error", err)
+			continue
+		}
+
+		resp, err := submitProofRequest(ctx, cfg, entry.Request, entry.Proxy)
+		if err == nil {
+			logger.Info("submitted queued proof", "phase", "outbox", "tree_id", entry.TreeId,
+				"wallet", entry.Request.WalletAddress, "attempts", entry.Attempts+1)
+			recordSubmission(entry.TreeId, entry.Root, entry.Height, entry.Request, resp)
+			o.finish(entry, nil)
+			continue
+		}
+		if ctx.Err() != nil {
+			// Shutting down, keep the entry as it is for the next run
+			return
+		}
+
+		entry.Attempts++
+		entry.LastError = err.Error()
+		switch {
+		case !clients.IsRetryable(err):
+			logger.Warn("dropping queued proof, submission rejected", "phase", "outbox", "tree_id", entry.TreeId,
+				"wallet", entry.Request.WalletAddress, "error", err)
+			o.finish(entry, nil)
+		case entry.Attempts >= outboxMaxAttempts:
+			logger.Warn("dropping queued proof, too many attempts", "phase", "outbox", "tree_id", entry.TreeId,
+				"wallet", entry.Request.WalletAddress, "attempts", entry.Attempts, "error", err)
+			o.finish(entry, nil)
+		default:
+			entry.NextAttempt = clock().Add(outboxBackoff(entry.Attempts))
+			logger.Warn("queued proof retry failed", "phase", "outbox", "tree_id", entry.TreeId,
+				"wallet", entry.Request.WalletAddress, "attempts", entry.Attempts, "next_attempt", entry.NextAttempt, "error", err)
+			o.finish(entry, &entry)
+		}
+	}
+}
+
+// finish removes the entry from the outbox, or replaces it with updated when
+// it is not nil, and persists the outbox
+func (o *Outbox) finish(entry OutboxEntry, updated *OutboxEntry) {
+	o.mu.Lock()
+	defer o.mu.Unlock()
+
+	for i := range o.entries {
+		if o.entries[i].key() != entry.key() || !o.entries[i].CreatedAt.Equal(entry.CreatedAt) {
+			continue
+		}
+		if updated != nil {
+			o.entries[i] = *updated
+		} else {
+			o.entries = append(o.entries[:i], o.entries[i+1:]...)
+		}
+		break
+	}
+
+	if err := o.save(); err != nil {
+		logger.Error("failed to save outbox", "phase", "outbox", "error", err)
+	}
+}
+
+func outboxBackoff(attempts int) time.Duration {
+	backoff := outboxBaseBackoff
+	for i := 1; i < attempts; i++ {
+		backoff *= 2
+		if backoff >= outboxMaxBackoff {
+			return outboxMaxBackoff
+		}
+	}
+	return backoff
+}
+
+var outbox, _ = OpenOutbox("")
+
+// SetOutbox replaces the outbox used to retry failed submissions
+func SetOutbox(o *Outbox) {
+	outbox = o
+}
@@ -0,0 +1,271 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"sync"
+	"testing"
+	"time"
+
+	"github.com/Layer-Edge/light-node/clients"
+	"github.com/Layer-Edge/light-node/config"
+	"github.com/Layer-Edge/light-node/utils"
+)
+
+// pointsServer answers submissions with status and records their requests
+type pointsServer struct {
+	*httptest.Server
+	mu       sync.Mutex
+	status   int
+	requests []SubmitProofRequest
+}
+
+func newPointsServer(t *testing.T, status int) *pointsServer {
+	server := &pointsServer{status: status}
+	server.Server = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var request SubmitProofRequest
+		if err := json.NewDecoder(r.Body).Decode(&request); err != nil {
+			t.Errorf("invalid submission: %v", err)
+		}
+		server.mu.Lock()
+		server.requests = append(server.requests, request)
+		status := server.status
+		server.mu.Unlock()
+
+		w.WriteHeader(status)
+		fmt.Fprint(w, `{"ok":true}`)
+	}))
+	t.Cleanup(server.Close)
+	return server
+}
+
+func (s *pointsServer) submissions() []SubmitProofRequest {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+	return append([]SubmitProofRequest(nil), s.requests...)
+}
+
+// setClock makes the package clock return *now for the duration of the test
+func setClock(t *testing.T, now *time.Time) {
+	previous := clock
+	clock = func() time.Time { return *now }
+	t.Cleanup(func() { clock = previous })
+}
+
+func queuedEntry(t *testing.T, outbox *Outbox, identity *Identity) OutboxEntry {
+	request := SubmitProofRequest{
+		WalletAddress: identity.Address(),
+		Sign:          "0xstale",
+		Timestamp:     "1",
+		Proof:         "leaf",
+		ProofHash:     utils.HashString("leaf"),
+		Receipt:       "receipt",
+	}
+	if err := outbox.Enqueue(OutboxEntry{Request: request, TreeId: "tree", Root: "root"}, errors.New("unavailable")); err != nil {
+		t.Fatalf("Enqueue: %v", err)
+	}
+	return outbox.Entries()[0]
+}
+
+func outboxConfig(url string) *config.Config {
+	cfg := config.Default()
+	cfg.Points.URL = url
+	cfg.RequestTimeout = config.Duration(5 * time.Second)
+	return cfg
+}
+
+func TestOutboxBackoff(t *testing.T) {
+	tests := []struct {
+		attempts int
+		want     time.Duration
+	}{
+		{1, outboxBaseBackoff},
+		{2, 2 * outboxBaseBackoff},
+		{3, 4 * outboxBaseBackoff},
+		{6, 32 * outboxBaseBackoff},
+		{7, outboxMaxBackoff},
+		{outboxMaxAttempts, outboxMaxBackoff},
+	}
+	for _, tt := range tests {
+		if got := outboxBackoff(tt.attempts); got != tt.want {
+			t.Errorf("outboxBackoff(%d) = %v, want %v", tt.attempts, got, tt.want)
+		}
+	}
+}
+
+func TestOutboxRetryResignsSubmission(t *testing.T) {
+	now := testNow
+	setClock(t, &now)
+
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	server := newPointsServer(t, http.StatusOK)
+	outbox, _ := OpenOutbox("")
+	entry := queuedEntry(t, outbox, identity)
+
+	// Nothing is due before the backoff elapses
+	signers := map[string]Signer{identity.Address(): identity}
+	outbox.retryDue(context.Background(), outboxConfig(server.URL), signers)
+	if len(server.submissions()) != 0 {
+		t.Fatal("entry retried before its backoff elapsed")
+	}
+
+	now = entry.NextAttempt
+	outbox.retryDue(context.Background(), outboxConfig(server.URL), signers)
+
+	submissions := server.submissions()
+	if len(submissions) != 1 {
+		t.Fatalf("got %d submissions, want 1", len(submissions))
+	}
+	request := submissions[0]
+	if want := fmt.Sprintf("%d", now.UnixMilli()); request.Timestamp != want {
+		t.Errorf("retry timestamp = %s, want %s", request.Timestamp, want)
+	}
+	msg := fmt.Sprintf("Submitting proof verification by %s of %s at %s", identity.Address(), request.Proof, request.Timestamp)
+	if err := utils.VerifyMessage(request.Sign, msg, identity.Address()); err != nil {
+		t.Errorf("retry is not signed for its timestamp: %v", err)
+	}
+	if pending := outbox.Entries(); len(pending) != 0 {
+		t.Errorf("submitted entry still pending: %+v", pending)
+	}
+}
+
+func TestOutboxRetryFailures(t *testing.T) {
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+
+	tests := []struct {
+		name        string
+		status      int
+		attempts    int  // Attempts already made before the retry
+		keep        bool // Whether the entry stays queued
+		wantBackoff time.Duration
+	}{
+		{name: "server error backs off", status: http.StatusServiceUnavailable, attempts: 1, keep: true, wantBackoff: 2 * outboxBaseBackoff},
+		{name: "rate limit backs off", status: http.StatusTooManyRequests, attempts: 3, keep: true, wantBackoff: 8 * outboxBaseBackoff},
+		{name: "max attempts", status: http.StatusBadGateway, attempts: outboxMaxAttempts - 1},
+		{name: "rejected", status: http.StatusBadRequest, attempts: 1},
+		{name: "unauthorized", status: http.StatusUnauthorized, attempts: 1},
+	}
+	for _, tt := range tests {
+		t.Run(tt.name, func(t *testing.T) {
+			now := testNow
+			setClock(t, &now)
+
+			server := newPointsServer(t, tt.status)
+			outbox, _ := OpenOutbox("")
+			entry := queuedEntry(t, outbox, identity)
+			entry.Attempts = tt.attempts
+			outbox.finish(entry, &entry)
+
+			now = entry.NextAttempt
+			outbox.retryDue(context.Background(), outboxConfig(server.URL), map[string]Signer{identity.Address(): identity})
+
+			if len(server.submissions()) != 1 {
+				t.Fatalf("got %d submissions, want 1", len(server.submissions()))
+			}
+			pending := outbox.Entries()
+			if !tt.keep {
+				if len(pending) != 0 {
+					t.Errorf("entry still pending: %+v", pending)
+				}
+				return
+			}
+			if len(pending) != 1 {
+				t.Fatalf("got %d pending entries, want 1", len(pending))
+			}
+			if pending[0].Attempts != tt.attempts+1 {
+				t.Errorf("Attempts = %d, want %d", pending[0].Attempts, tt.attempts+1)
+			}
+			if want := now.Add(tt.wantBackoff); !pending[0].NextAttempt.Equal(want) {
+				t.Errorf("NextAttempt = %v, want %v", pending[0].NextAttempt, want)
+			}
+		})
+	}
+}
+
+func TestOutboxRetryUnknownWallet(t *testing.T) {
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	server := newPointsServer(t, http.StatusOK)
+	outbox, _ := OpenOutbox("")
+	entry := queuedEntry(t, outbox, identity)
+
+	now := entry.NextAttempt
+	setClock(t, &now)
+	outbox.retryDue(context.Background(), outboxConfig(server.URL), map[string]Signer{})
+
+	if len(server.submissions()) != 0 {
+		t.Error("entry submitted without the key of its wallet")
+	}
+	if pending := outbox.Entries(); len(pending) != 0 {
+		t.Errorf("entry of an unknown wallet still pending: %+v", pending)
+	}
+}
+
+func TestOutboxRetryCancelled(t *testing.T) {
+	identity, err := NewIdentity(testPrivateKey)
+	if err != nil {
+		t.Fatalf("NewIdentity: %v", err)
+	}
+	outbox, _ := OpenOutbox("")
+	entry := queuedEntry(t, outbox, identity)
+
+	// The node shuts down while the points API answers
+	ctx, cancel := context.WithCancel(context.Background())
+	defer cancel()
+	server := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		cancel()
+		w.WriteHeader(http.StatusServiceUnavailable)
+	}))
+	defer server.Close()
+
+	now := entry.NextAttempt
+	setClock(t, &now)
+	outbox.retryDue(ctx, outboxConfig(server.URL), map[string]Signer{identity.Address(): identity})
+
+	// A retry interrupted by shutdown is not counted as an attempt
+	pending := outbox.Entries()
+	if len(pending) != 1 || pending[0].Attempts != entry.Attempts {
+		t.Errorf("pending = %+v, want the entry unchanged", pending)
+	}
+}
+
+func TestIsRetryableContext(t *testing.T) {
+	ctx, cancel := context.WithCancel(context.Background())
+	cancel()
+	_, err := clients.PostRequest[SubmitProofRequest, map[string]interface{}](ctx, "http://127.0.0.1:1", SubmitProofRequest{})
+	if err == nil {
+		t.Fatal("PostRequest succeeded with a cancelled context")
+	}
+	if clients.IsRetryable(err) {
+		t.Errorf("IsRetryable(%v) = true for a cancelled request", err)
+	}
+
+	ctx, cancel = context.WithDeadline(context.Background(), time.Now().Add(-time.Second))
+	defer cancel()
+	_, err = clients.PostRequest[SubmitProofRequest, map[string]interface{}](ctx, "http://127.0.0.1:1", SubmitProofRequest{})
+	if err == nil || clients.IsRetryable(err) {
+		t.Errorf("IsRetryable(%v) = true for a request past its context deadline", err)
+	}
+
+	if !clients.IsRetryable(fmt.Errorf("error making request: %v", context.DeadlineExceeded)) {
+		t.Error("client timeouts are not retryable")
+	}
+	if !clients.IsRetryable(&clients.HTTPError{StatusCode: http.StatusServiceUnavailable}) {
+		t.Error("503 is not retryable")
+	}
+	if clients.IsRetryable(&clients.HTTPError{StatusCode: http.StatusForbidden}) {
+		t.Error("403 is retryable")
+	}
+}
@@ -0,0 +1,46 @@
+package node
+
+// Outcome describes how the last verification attempt of a tree ended
+type Outcome string
+
+const (
+	OutcomeSubmitted        Outcome = "submitted"
+	OutcomeTreeInconsistent Outcome = "tree_inconsistent"
+	OutcomeProveFailed      Outcome = "prove_failed"
+	OutcomeVerifyFailed     Outcome = "verify_failed"
+	OutcomeSubmitFailed     Outcome = "submit_failed"
+	OutcomeSubmitQueued     Outcome = "submit_queued"
+	OutcomeDryRun           Outcome = "dry_run"
+)
+
+// recordOutcome stores the outcome of the latest attempt on the tree state
+func recordOutcome(treeId string, outcome Outcome) {
+	treeOutcomes.WithLabelValues(string(outcome)).Inc()
+
+	_, err := stateStore.Update(treeId, func(state *TreeState, exists bool) {
+		state.LastOutcome = outcome
+		state.LastOutcomeAt = clock()
+	})
+	if err != nil {
+		logger.Error("failed to save tree outcome", "tree_id", treeId, "error", err)
+	}
+}
+
+// GetInconsistentTrees returns the trees whose leaves did not hash to the
+// on-chain root on the latest attempt
+func GetInconsistentTrees() []string {
+	states, err := stateStore.All()
+	if err != nil {
+		logger.Error("failed to load tree states", "error", err)
+		return nil
+	}
+
+	var trees []string
+	for treeId, state := range states {
+		if state.LastOutcome == OutcomeTreeInconsistent {
+			trees = append(trees, treeId)
+		}
+	}
+
+	return trees
+}
@@ -0,0 +1,231 @@
+package node
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"strings"
+	"time"
+
+	"github.com/Layer-Edge/light-node/clients"
+	"github.com/Layer-Edge/light-node/config"
+	"github.com/Layer-Edge/light-node/merkle"
+)
+
+// Prover generates and verifies Merkle inclusion proofs for a tree
+type Prover interface {
+	// Prove builds the inclusion proof of proofRequest in the tree built from data
+	Prove(ctx context.Context, data []string, proofRequest string) (*Proof, error)
+	// Verify checks the proof against the tree built from data. The response
+	// Receipt holds the hex encoded journal of the verification.
+	Verify(ctx context.Context, data []string, proof Proof) (*ZKProverResponse, error)
+	// Ping checks that the prover is reachable
+	Ping(ctx context.Context) error
+}
+
+const (
+	ProverBackendHTTP   = "http"
+	ProverBackendMerkle = "merkle"
+)
+
+// NewProver creates the prover selected by cfg.Prover.Backend. The http
+// backend uses every configured URL, in priority order, failing over to the
+// next one when a request fails.
+func NewProver(cfg *config.Config, proxy string) (Prover, error) {
+	switch cfg.Prover.Backend {
+	case ProverBackendMerkle:
+		return &MerkleProver{}, nil
+	case ProverBackendHTTP, "":
+		var provers []Prover
+		for _, proverURL := range cfg.Prover.URLs {
+			provers = append(provers, &HTTPProver{URL: proverURL, Proxy: proxy, Timeout: cfg.RequestTimeout.Duration()})
+		}
+		if len(provers) == 0 {
+			return nil, fmt.Errorf("no prover URL configured")
+		}
+		if len(provers) == 1 {
+			return provers[0], nil
+		}
+		return &FailoverProver{Provers: provers}, nil
+	default:
+		return nil, fmt.Errorf("unknown prover backend %q", cfg.Prover.Backend)
+	}
+}
+
+// IsDryRun reports whether the prover only produces local results that the
+// points API would not accept
+func IsDryRun(prover Prover) bool {
+	_, ok := prover.(*MerkleProver)
+	return ok
+}
+
+// HTTPProver calls the /process endpoint of the RISC Zero host service
+type HTTPProver struct {
+	URL     string
+	Proxy   string
+	Timeout time.Duration // Request timeout, clients.DEFAULT_TIMEOUT when 0
+}
+
+func (p *HTTPProver) Prove(ctx context.Context, data []string, proofRequest string) (*Proof, error) {
+	resp, err := p.process(ctx, ZKProverPayload{
+		Operation:    "prove",
+		Data:         data,
+		ProofRequest: &proofRequest,
+		Proof:        nil,
+	})
+	if err != nil {
+		return nil, err
+	}
+	return resp.Proof, nil
+}
+
+func (p *HTTPProver) Verify(ctx context.Context, data []string, proof Proof) (*ZKProverResponse, error) {
+	return p.process(ctx, ZKProverPayload{
+		Operation:    "verify",
+		Data:         data,
+		ProofRequest: nil,
+		Proof:        &proof,
+	})
+}
+
+// Ping opens a TCP connection to the prover host. The host service only
+// serves POST /process, so reachability is the strongest cheap check.
+func (p *HTTPProver) Ping(ctx context.Context) error {
+	u, err := url.Parse(p.URL)
+	if err != nil {
+		return fmt.Errorf("invalid prover URL %s: %v", p.URL, err)
+	}
+	host := u.Host
+	if u.Port() == "" {
+		if u.Scheme == "https" {
+			host = net.JoinHostPort(u.Hostname(), "443")
+		} else {
+			host = net.JoinHostPort(u.Hostname(), "80")
+		}
+	}
+
+	var dialer net.Dialer
+	conn, err := dialer.DialContext(ctx, "tcp", host)
+	if err != nil {
+		return fmt.Errorf("prover %s is unreachable: %v", p.URL, err)
+	}
+	return conn.Close()
+}
+
+func (p *HTTPProver) process(ctx context.Context, payload ZKProverPayload) (*ZKProverResponse, error) {
+	// Use the worker's proxy when it has one
+	options := clients.RequestOptions{
+		Proxy:   p.Proxy,
+		Timeout: int(p.Timeout / time.Second),
+	}
+	logger.Debug("sending prover request", "phase", payload.Operation, "prover", p.URL, "proxy", p.Proxy != "")
+
+	resp, err := clients.PostRequest[ZKProverPayload, ZKProverResponse](
+		ctx,
+		strings.TrimSuffix(p.URL, "/")+"/process",
+		payload,
+		options,
+	)
+	if err != nil {
+		if p.Proxy != "" {
+			return nil, fmt.Errorf("%s request to %s through proxy failed: %v", payload.Operation, p.URL, err)
+		}
+		return nil, fmt.Errorf("%s request to %s failed: %v", payload.Operation, p.URL, err)
+	}
+	return resp, nil
+}
+
+// MerkleProver computes proofs in-process with the merkle package. It
+// produces no ZK receipt, only a journal with the same layout as the guest,
+// and is meant for dry runs.
+type MerkleProver struct{}
+
+func (p *MerkleProver) Prove(ctx context.Context, data []string, proofRequest string) (*Proof, error) {
+	proof, err := merkle.New(data).GenerateProof(proofRequest)
+	if err != nil {
+		return nil, err
+	}
+	return &Proof{
+		LeafValue: proof.LeafValue,
+		ProofPath: merkle.PathFromSteps(proof.ProofPath),
+	}, nil
+}
+
+func (p *MerkleProver) Verify(ctx context.Context, data []string, proof Proof) (*ZKProverResponse, error) {
+	steps, err := merkle.StepsFromPath(proof.ProofPath)
+	if err != nil {
+		return nil, err
+	}
+
+	tree := merkle.New(data)
+	root := tree.Root()
+	verified := tree.VerifyProof(merkle.Proof{LeafValue: proof.LeafValue, ProofPath: steps})
+
+	journal, err := EncodeJournal(Journal{Root: &root, Verified: &verified})
+	if err != nil {
+		return nil, err
+	}
+
+	return &ZKProverResponse{
+		Root:     root,
+		Verified: verified,
+		Receipt:  journal,
+	}, nil
+}
+
+func (p *MerkleProver) Ping(ctx context.Context) error {
+	return nil
+}
+
+// FailoverProver tries each prover in priority order and returns the first
+// successful result
+type FailoverProver struct {
+	Provers []Prover
+}
+
+func (p *FailoverProver) Prove(ctx context.Context, data []string, proofRequest string) (*Proof, error) {
+	var errs []error
+	for _, prover := range p.Provers {
+		proof, err := prover.Prove(ctx, data, proofRequest)
+		if err == nil {
+			return proof, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		logger.Warn("prover failed, trying next", "error", err)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("all provers failed: %w", errors.Join(errs...))
+}
+
+func (p *FailoverProver) Verify(ctx context.Context, data []string, proof Proof) (*ZKProverResponse, error) {
+	var errs []error
+	for _, prover := range p.Provers {
+		resp, err := prover.Verify(ctx, data, proof)
+		if err == nil {
+			return resp, nil
+		}
+		if ctx.Err() != nil {
+			return nil, ctx.Err()
+		}
+		logger.Warn("prover failed, trying next", "error", err)
+		errs = append(errs, err)
+	}
+	return nil, fmt.Errorf("all provers failed: %w", errors.Join(errs...))
+}
+
+// Ping succeeds when at least one prover is reachable
+func (p *FailoverProver) Ping(ctx context.Context) error {
+	var errs []error
+	for _, prover := range p.Provers {
+		err := prover.Ping(ctx)
+		if err == nil {
+			return nil
+		}
+		errs = append(errs, err)
+	}
+	return fmt.Errorf("no prover is reachable: %w", errors.Join(errs...))
+}
@@ -0,0 +1,103 @@
+package node
+
+import (
+	"fmt"
+	"time"
+
+	"github.com/Layer-Edge/light-node/config"
+)
+
+// Clock returns the current time. A nil Clock reads time.Now.
+type Clock func() time.Time
+
+func (c Clock) Now() time.Time {
+	if c == nil {
+		return time.Now()
+	}
+	return c()
+}
+
+// SleepPolicy decides how long a tree sleeps once its root has stayed the same
+type SleepPolicy interface {
+	// SleepDuration returns how long to sleep after the root has been seen
+	// unchanged consecutiveSame times in a row, or 0 to keep checking
+	SleepDuration(consecutiveSame int) time.Duration
+	// SleepUntil returns the time to sleep until after consecutiveSame
+	// unchanged roots, or the zero time to keep checking
+	SleepUntil(consecutiveSame int) time.Time
+}
+
+// FixedSleepPolicy sleeps for Duration once the root has stayed the same for
+// Threshold checks
+type FixedSleepPolicy struct {
+	Threshold int
+	Duration  time.Duration
+	Clock     Clock
+}
+
+func (p FixedSleepPolicy) SleepDuration(consecutiveSame int) time.Duration {
+	if consecutiveSame < p.Threshold {
+		return 0
+	}
+	return p.Duration
+}
+
+func (p FixedSleepPolicy) SleepUntil(consecutiveSame int) time.Time {
+	return sleepUntil(p.Clock, p.SleepDuration(consecutiveSame))
+}
+
+// ExponentialSleepPolicy starts like FixedSleepPolicy and multiplies the sleep
+// by Factor for every further check with the same root, up to Max. A changed
+// root resets the counter and therefore the sleep.
+type ExponentialSleepPolicy struct {
+	Threshold int
+	Base      time.Duration
+	Factor    float64
+	Max       time.Duration
+	Clock     Clock
+}
+
+func (p ExponentialSleepPolicy) SleepDuration(consecutiveSame int) time.Duration {
+	if consecutiveSame < p.Threshold {
+		return 0
+	}
+
+	sleep := p.Base
+	for i := p.Threshold; i < consecutiveSame; i++ {
+		sleep = time.Duration(float64(sleep) * p.Factor)
+		if p.Max > 0 && sleep >= p.Max {
+			return p.Max
+		}
+	}
+	return sleep
+}
+
+func (p ExponentialSleepPolicy) SleepUntil(consecutiveSame int) time.Time {
+	return sleepUntil(p.Clock, p.SleepDuration(consecutiveSame))
+}
+
+func sleepUntil(clock Clock, sleep time.Duration) time.Time {
+	if sleep <= 0 {
+		return time.Time{}
+	}
+	return clock.Now().Add(sleep)
+}
+
+// NewSleepPolicy builds the policy selected by cfg.Policy (fixed or
+// exponential), reading the time from clock
+func NewSleepPolicy(cfg config.SleepConfig, clock Clock) (SleepPolicy, error) {
+	switch cfg.Policy {
+	case "fixed":
+		return FixedSleepPolicy{Threshold: cfg.Threshold, Duration: cfg.Duration.Duration(), Clock: clock}, nil
+	case "exponential":
+		return ExponentialSleepPolicy{
+			Threshold: cfg.Threshold,
+			Base:      cfg.Duration.Duration(),
+			Factor:    cfg.BackoffFactor,
+			Max:       cfg.MaxDuration.Duration(),
+			Clock:     clock,
+		}, nil
+	default:
+		return nil, fmt.Errorf("unknown sleep policy %q, expected fixed or exponential", cfg.Policy)
+	}
+}
@@ -0,0 +1,124 @@
+package node
+
+import (
+	"testing"
+	"time"
+
+	"github.com/Layer-Edge/light-node/config"
+)
+
+var testNow = time.Date(2024, 1, 1, 12, 0, 0, 0, time.UTC)
+
+func fixedClock() time.Time { return testNow }
+
+func TestFixedSleepPolicy(t *testing.T) {
+	policy := FixedSleepPolicy{Threshold: 3, Duration: time.Hour, Clock: fixedClock}
+
+	for consecutiveSame, want := range []time.Duration{0, 0, 0, time.Hour, time.Hour, time.Hour} {
+		if got := policy.SleepDuration(consecutiveSame); got != want {
+			t.Errorf("SleepDuration(%d) = %v, want %v", consecutiveSame, got, want)
+		}
+	}
+
+	if until := policy.SleepUntil(2); !until.IsZero() {
+		t.Errorf("SleepUntil below the threshold = %v, want zero", until)
+	}
+	if until := policy.SleepUntil(3); !until.Equal(testNow.Add(time.Hour)) {
+		t.Errorf("SleepUntil(3) = %v, want %v", until, testNow.Add(time.Hour))
+	}
+}
+
+func TestExponentialSleepPolicy(t *testing.T) {
+	policy := ExponentialSleepPolicy{
+		Threshold: 2,
+		Base:      time.Minute,
+		Factor:    2,
+		Max:       10 * time.Minute,
+		Clock:     fixedClock,
+	}
+
+	tests := []struct {
+		consecutiveSame int
+		want            time.Duration
+	}{
+		{0, 0},
+		{1, 0},
+		{2, time.Minute},
+		{3, 2 * time.Minute},
+		{4, 4 * time.Minute},
+		{5, 8 * time.Minute},
+		{6, 10 * time.Minute}, // 16m capped
+		{50, 10 * time.Minute},
+	}
+	for _, tt := range tests {
+		if got := policy.SleepDuration(tt.consecutiveSame); got != tt.want {
+			t.Errorf("SleepDuration(%d) = %v, want %v", tt.consecutiveSame, got, tt.want)
+		}
+	}
+
+	if until := policy.SleepUntil(4); !until.Equal(testNow.Add(4 * time.Minute)) {
+		t.Errorf("SleepUntil(4) = %v, want %v", until, testNow.Add(4*time.Minute))
+	}
+
+	uncapped := policy
+	uncapped.Max = 0
+	if got := uncapped.SleepDuration(12); got != 1024*time.Minute {
+		t.Errorf("SleepDuration(12) without Max = %v, want %v", got, 1024*time.Minute)
+	}
+}
+
+func TestTreeStateObserveRoot(t *testing.T) {
+	now := testNow
+	policy := FixedSleepPolicy{Threshold: 2, Duration: time.Hour, Clock: func() time.Time { return now }}
+
+	var state TreeState
+	state.ObserveRoot("root1", policy)
+	if state.LastRoot != "root1" || state.ConsecutiveSame != 0 {
+		t.Fatalf("first check: state = %+v", state)
+	}
+
+	state.ObserveRoot("root1", policy)
+	if state.ConsecutiveSame != 1 || state.SleepingAt(now) {
+		t.Fatalf("below the threshold: state = %+v", state)
+	}
+
+	state.ObserveRoot("root1", policy)
+	if state.ConsecutiveSame != 2 || !state.SleepingAt(now) {
+		t.Fatalf("at the threshold: state = %+v", state)
+	}
+	if !state.SleepUntil.Equal(now.Add(time.Hour)) {
+		t.Errorf("SleepUntil = %v, want %v", state.SleepUntil, now.Add(time.Hour))
+	}
+
+	now = now.Add(time.Hour)
+	if state.SleepingAt(now) {
+		t.Errorf("tree still sleeping at %v", now)
+	}
+
+	// A changed root resets the counter, so the next unchanged check does not
+	// put the tree back to sleep
+	state.ObserveRoot("root2", policy)
+	if state.LastRoot != "root2" || state.ConsecutiveSame != 0 {
+		t.Fatalf("changed root: state = %+v", state)
+	}
+	state.ObserveRoot("root2", policy)
+	if state.ConsecutiveSame != 1 || state.SleepingAt(now) {
+		t.Errorf("after reset: state = %+v", state)
+	}
+}
+
+func TestNewSleepPolicy(t *testing.T) {
+	cfg := config.SleepConfig{Policy: "exponential", Threshold: 1, BackoffFactor: 2}
+	policy, err := NewSleepPolicy(cfg, fixedClock)
+	if err != nil {
+		t.Fatalf("NewSleepPolicy: %v", err)
+	}
+	if _, ok := policy.(ExponentialSleepPolicy); !ok {
+		t.Errorf("policy is %T, want ExponentialSleepPolicy", policy)
+	}
+
+	cfg.Policy = "linear"
+	if _, err := NewSleepPolicy(cfg, fixedClock); err == nil {
+		t.Error("NewSleepPolicy accepted an unknown policy")
+	}
+}
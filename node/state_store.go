@@ -0,0 +1,156 @@
+package node
+
+import (
+	"encoding/json"
+	"fmt"
+	"os"
+	"path/filepath"
+	"sync"
+)
+
+// TreeStateStore keeps the per-tree state used to decide which trees to
+// verify. Implementations must be safe for concurrent use by all workers.
+type TreeStateStore interface {
+	// Get returns a copy of the state of the tree
+	Get(treeId string) (TreeState, bool, error)
+	// Update atomically applies fn to the state of the tree, creating an
+	// empty state first when the tree is unknown, and returns the result
+	Update(treeId string, fn func(state *TreeState, exists bool)) (TreeState, error)
+	// All returns a snapshot of every tree state
+	All() (map[string]TreeState, error)
+}
+
+// MemoryTreeStateStore keeps tree states in memory only
+type MemoryTreeStateStore struct {
+	mu     sync.Mutex
+	states map[string]TreeState
+}
+
+func NewMemoryTreeStateStore() *MemoryTreeStateStore {
+	return &MemoryTreeStateStore{states: make(map[string]TreeState)}
+}
+
+func (s *MemoryTreeStateStore) Get(treeId string) (TreeState, bool, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state, exists := s.states[treeId]
+	return state, exists, nil
+}
+
+func (s *MemoryTreeStateStore) Update(treeId string, fn func(state *TreeState, exists bool)) (TreeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.update(treeId, fn), nil
+}
+
+func (s *MemoryTreeStateStore) update(treeId string, fn func(state *TreeState, exists bool)) TreeState {
+	state, exists := s.states[treeId]
+	fn(&state, exists)
+	s.states[treeId] = state
+	return state
+}
+
+func (s *MemoryTreeStateStore) All() (map[string]TreeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	return s.snapshot(), nil
+}
+
+func (s *MemoryTreeStateStore) snapshot() map[string]TreeState {
+	states := make(map[string]TreeState, len(s.states))
+	for treeId, state := range s.states {
+		states[treeId] = state
+	}
+	return states
+}
+
+// FileTreeStateStore keeps tree states in memory and writes them to a JSON
+// file after every update, so sleeping trees and known roots survive restarts
+type FileTreeStateStore struct {
+	MemoryTreeStateStore
+	path string
+}
+
+// NewFileTreeStateStore opens the store at path, loading any states saved by
+// a previous run
+func NewFileTreeStateStore(path string) (*FileTreeStateStore, error) {
+	store := &FileTreeStateStore{
+		MemoryTreeStateStore: MemoryTreeStateStore{states: make(map[string]TreeState)},
+		path:                 path,
+	}
+
+	data, err := os.ReadFile(path)
+	if err != nil && !os.IsNotExist(err) {
+		return nil, fmt.Errorf("failed to read tree state file %s: %v", path, err)
+	}
+	if len(data) > 0 {
+		if err := json.Unmarshal(data, &store.states); err != nil {
+			return nil, fmt.Errorf("failed to parse tree state file %s: %v", path, err)
+		}
+	}
+
+	return store, nil
+}
+
+// Update applies fn and persists the result. The in-memory state is updated
+// even when writing the file fails.
+func (s *FileTreeStateStore) Update(treeId string, fn func(state *TreeState, exists bool)) (TreeState, error) {
+	s.mu.Lock()
+	defer s.mu.Unlock()
+
+	state := s.update(treeId, fn)
+	return state, s.save()
+}
+
+func (s *FileTreeStateStore) save() error {
+	return writeJSONFile(s.path, s.states)
+}
+
+// writeJSONFile writes v as indented JSON to a temporary file, flushed to
+// disk, and renames it over path, then flushes the directory so the rename is
+// durable. A crash thus leaves either the previous or the new file behind,
+// never a truncated one.
+func writeJSONFile(path string, v interface{}) error {
+	data, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return fmt.Errorf("failed to marshal %s: %v", path, err)
+	}
+
+	tmp, err := os.CreateTemp(filepath.Dir(path), filepath.Base(path)+".*.tmp")
+	if err != nil {
+		return fmt.Errorf("failed to create temporary file for %s: %v", path, err)
+	}
+	defer os.Remove(tmp.Name())
+
+	if _, err := tmp.Write(data); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := tmp.Sync(); err != nil {
+		tmp.Close()
+		return fmt.Errorf("failed to flush %s: %v", path, err)
+	}
+	if err := tmp.Close(); err != nil {
+		return fmt.Errorf("failed to write %s: %v", path, err)
+	}
+	if err := os.Rename(tmp.Name(), path); err != nil {
+		return fmt.Errorf("failed to replace %s: %v", path, err)
+	}
+	return syncDir(filepath.Dir(path))
+}
+
+// syncDir flushes the entries of a directory, such as a rename, to disk
+func syncDir(path string) error {
+	dir, err := os.Open(path)
+	if err != nil {
+		return fmt.Errorf("failed to open directory %s: %v", path, err)
+	}
+	defer dir.Close()
+	if err := dir.Sync(); err != nil {
+		return fmt.Errorf("failed to flush directory %s: %v", path, err)
+	}
+	return nil
+}
@@ -0,0 +1,83 @@
+package node
+
+import (
+	"os"
+	"path/filepath"
+	"reflect"
+	"testing"
+	"time"
+)
+
+func TestFileTreeStateStoreReopen(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree_state.json")
+	store, err := NewFileTreeStateStore(path)
+	if err != nil {
+		t.Fatalf("NewFileTreeStateStore: %v", err)
+	}
+
+	policy := FixedSleepPolicy{Threshold: 1, Duration: time.Hour, Clock: fixedClock}
+	for _, root := range []string{"root-a", "root-a"} {
+		if _, err := store.Update("tree-a", func(state *TreeState, exists bool) {
+			state.ObserveRoot(root, policy)
+		}); err != nil {
+			t.Fatalf("Update: %v", err)
+		}
+	}
+	if _, err := store.Update("tree-b", func(state *TreeState, exists bool) {
+		state.LastRoot = "root-b"
+		state.LastOutcome = OutcomeSubmitted
+		state.LastOutcomeAt = testNow
+		state.LastSubmittedRoot = "root-b"
+		state.LastSubmittedAt = testNow
+	}); err != nil {
+		t.Fatalf("Update: %v", err)
+	}
+	want, _ := store.All()
+
+	// A new run loads every state saved by the previous one
+	reopened, err := NewFileTreeStateStore(path)
+	if err != nil {
+		t.Fatalf("reopening the store: %v", err)
+	}
+	states, err := reopened.All()
+	if err != nil {
+		t.Fatalf("All: %v", err)
+	}
+	if len(states) != 2 {
+		t.Fatalf("reopened store has %d trees, want 2", len(states))
+	}
+	for treeId, state := range want {
+		// Times come back in the local time zone of the JSON decoding
+		got := states[treeId]
+		if !got.SleepUntil.Equal(state.SleepUntil) || !got.LastOutcomeAt.Equal(state.LastOutcomeAt) || !got.LastSubmittedAt.Equal(state.LastSubmittedAt) {
+			t.Errorf("tree %s times = %+v, want %+v", treeId, got, state)
+		}
+		got.SleepUntil, got.LastOutcomeAt, got.LastSubmittedAt = state.SleepUntil, state.LastOutcomeAt, state.LastSubmittedAt
+		if !reflect.DeepEqual(got, state) {
+			t.Errorf("tree %s = %+v, want %+v", treeId, got, state)
+		}
+	}
+	tree := states["tree-a"]
+	if !tree.SleepingAt(testNow) {
+		t.Error("sleeping tree woke up across the restart")
+	}
+
+	// No temporary file is left next to the store
+	entries, err := os.ReadDir(filepath.Dir(path))
+	if err != nil {
+		t.Fatalf("ReadDir: %v", err)
+	}
+	if len(entries) != 1 {
+		t.Errorf("files next to the store: %v", entries)
+	}
+}
+
+func TestFileTreeStateStoreCorrupt(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "tree_state.json")
+	if err := os.WriteFile(path, []byte(`{"tree-a":`), 0o600); err != nil {
+		t.Fatalf("WriteFile: %v", err)
+	}
+	if _, err := NewFileTreeStateStore(path); err == nil {
+		t.Error("NewFileTreeStateStore loaded a truncated file")
+	}
+}
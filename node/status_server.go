@@ -0,0 +1,178 @@
+package node
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"strconv"
+	"time"
+
+	"github.com/Layer-Edge/light-node/clients"
+	"github.com/Layer-Edge/light-node/config"
+)
+
+const readinessTimeout = 5 * time.Second
+
+// GetTreeStates returns the state of every known tree
+func GetTreeStates() (map[string]TreeState, error) {
+	return stateStore.All()
+}
+
+// WakeTree clears the sleep of a tree so the next worker run checks it again
+func WakeTree(treeId string) (TreeState, error) {
+	if _, exists, err := stateStore.Get(treeId); err != nil {
+		return TreeState{}, err
+	} else if !exists {
+		return TreeState{}, fmt.Errorf("unknown tree %s", treeId)
+	}
+
+	return stateStore.Update(treeId, func(state *TreeState, exists bool) {
+		state.SleepUntil = time.Time{}
+		state.ConsecutiveSame = 0
+	})
+}
+
+// RecentSubmissions returns up to limit ledger records, newest first
+func RecentSubmissions(limit int) []SubmissionRecord {
+	records := ledger.Records()
+	recent := make([]SubmissionRecord, 0, limit)
+	for i := len(records) - 1; i >= 0 && len(recent) < limit; i-- {
+		recent = append(recent, records[i])
+	}
+	return recent
+}
+
+// CheckReadiness checks that the gRPC endpoint answers contract queries and
+// that the prover is reachable. The map holds one entry per dependency, with
+// a nil error when it is ready.
+func CheckReadiness(ctx context.Context, cosmosQueryClient *clients.CosmosQueryClient, prover Prover) map[string]error {
+	ctx, cancel := context.WithTimeout(ctx, readinessTimeout)
+	defer cancel()
+
+	results := map[string]error{}
+
+	// The first page is enough to know the contract answers
+	results["grpc"] = nil
+	for _, err := range cosmosQueryClient.MerkleTreeIds(ctx) {
+		results["grpc"] = err
+		break
+	}
+
+	results["prover"] = prover.Ping(ctx)
+
+	return results
+}
+
+// ServeStatus serves the local status and admin API on the StatusAddr of the
+// current configuration until ctx is cancelled:
+//
+//	GET  /healthz               process is up
+//	GET  /readyz                gRPC endpoint and prover are reachable
+//	GET  /trees                 state of every known tree
+//	POST /trees/{id}/wake       wake a sleeping tree
+//	GET  /workers               latest result of every worker
+//	GET  /endpoints             health and latency of every gRPC endpoint
+//	GET  /submissions?limit=50  most recent submissions
+func ServeStatus(ctx context.Context, store *config.Store, cosmosQueryClient *clients.CosmosQueryClient) error {
+	addr := store.Current().StatusAddr
+	mux := http.NewServeMux()
+
+	mux.HandleFunc("GET /healthz", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, map[string]string{"status": "ok"})
+	})
+
+	mux.HandleFunc("GET /readyz", func(w http.ResponseWriter, r *http.Request) {
+		cfg := store.Current()
+		prover, err := NewProver(cfg, "")
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+
+		code := http.StatusOK
+		checks := map[string]string{}
+		for name, err := range CheckReadiness(r.Context(), cosmosQueryClient, prover) {
+			if err != nil {
+				checks[name] = err.Error()
+				code = http.StatusServiceUnavailable
+			} else {
+				checks[name] = "ok"
+			}
+		}
+		writeJSON(w, code, checks)
+	})
+
+	mux.HandleFunc("GET /trees", func(w http.ResponseWriter, r *http.Request) {
+		states, err := GetTreeStates()
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		writeJSON(w, http.StatusOK, states)
+	})
+
+	mux.HandleFunc("POST /trees/{id}/wake", func(w http.ResponseWriter, r *http.Request) {
+		treeId := r.PathValue("id")
+		if _, exists, _ := stateStore.Get(treeId); !exists {
+			writeError(w, http.StatusNotFound, fmt.Errorf("unknown tree %s", treeId))
+			return
+		}
+		state, err := WakeTree(treeId)
+		if err != nil {
+			writeError(w, http.StatusInternalServerError, err)
+			return
+		}
+		logger.Info("tree woken up through the status API", "tree_id", treeId)
+		writeJSON(w, http.StatusOK, state)
+	})
+
+	mux.HandleFunc("GET /workers", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, GetWorkerStatuses())
+	})
+
+	mux.HandleFunc("GET /endpoints", func(w http.ResponseWriter, r *http.Request) {
+		writeJSON(w, http.StatusOK, cosmosQueryClient.Endpoints())
+	})
+
+	mux.HandleFunc("GET /submissions", func(w http.ResponseWriter, r *http.Request) {
+		limit := 50
+		if value := r.URL.Query().Get("limit"); value != "" {
+			parsed, err := strconv.Atoi(value)
+			if err != nil || parsed < 1 {
+				writeError(w, http.StatusBadRequest, fmt.Errorf("limit must be a positive integer"))
+				return
+			}
+			limit = parsed
+		}
+		writeJSON(w, http.StatusOK, RecentSubmissions(limit))
+	})
+
+	server := &http.Server{Addr: addr, Handler: mux}
+
+	go func() {
+		<-ctx.Done()
+		shutdownCtx, cancel := context.WithTimeout(context.Background(), 5*time.Second)
+		defer cancel()
+		server.Shutdown(shutdownCtx)
+	}()
+
+	logger.Info("serving status API", "addr", "http://"+addr)
+	if err := server.ListenAndServe(); err != nil && !errors.Is(err, http.ErrServerClosed) {
+		return err
+	}
+	return nil
+}
+
+func writeJSON(w http.ResponseWriter, code int, v interface{}) {
+	w.Header().Set("Content-Type", "application/json")
+	w.WriteHeader(code)
+	if err := json.NewEncoder(w).Encode(v); err != nil {
+		logger.Warn("failed to write status response", "error", err)
+	}
+}
+
+func writeError(w http.ResponseWriter, code int, err error) {
+	writeJSON(w, code, map[string]string{"error": err.Error()})
+}
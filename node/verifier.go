@@ -1,12 +1,18 @@
 package node
 
 import (
+	"context"
 	"fmt"
-	"log"
-	"sync"
+	"iter"
+	"log/slog"
+	"regexp"
+	"slices"
+	"strings"
 	"time"
 
 	"github.com/Layer-Edge/light-node/clients"
+	"github.com/Layer-Edge/light-node/config"
+	"github.com/Layer-Edge/light-node/merkle"
 	"github.com/Layer-Edge/light-node/utils"
 )
 
@@ -38,9 +44,33 @@ type Proof struct {
 
 // TreeState stores the state of each merkle tree
 type TreeState struct {
-	LastRoot        string    // Last known root hash
-	SleepUntil      time.Time // Time until which the tree should sleep
-	ConsecutiveSame int       // Counter for consecutive same root occurrences
+	LastRoot          string    `json:"last_root"`           // Last known root hash
+	SleepUntil        time.Time `json:"sleep_until"`         // Time until which the tree should sleep
+	ConsecutiveSame   int       `json:"consecutive_same"`    // Counter for consecutive same root occurrences
+	LastOutcome       Outcome   `json:"last_outcome"`        // Outcome of the latest verification attempt
+	LastOutcomeAt     time.Time `json:"last_outcome_at"`     // Time the latest outcome was recorded
+	LastSubmittedRoot string    `json:"last_submitted_root"` // Root of the latest successful submission
+	LastSubmittedAt   time.Time `json:"last_submitted_at"`   // Time of the latest successful submission
+}
+
+// ObserveRoot records a check that found root. A changed root resets the
+// counter, an unchanged one lets policy put the tree to sleep.
+func (s *TreeState) ObserveRoot(root string, policy SleepPolicy) {
+	if s.LastRoot != root {
+		s.LastRoot = root
+		s.ConsecutiveSame = 0
+		return
+	}
+
+	s.ConsecutiveSame++
+	if until := policy.SleepUntil(s.ConsecutiveSame); !until.IsZero() {
+		s.SleepUntil = until
+	}
+}
+
+// SleepingAt reports whether the tree is asleep at now
+func (s *TreeState) SleepingAt(now time.Time) bool {
+	return now.Before(s.SleepUntil)
 }
 
 type SubmitProofRequest struct {
@@ -52,243 +82,435 @@ type SubmitProofRequest struct {
 	Receipt       string `json:"receipt"`
 }
 
-var zkProverURL = utils.GetEnv("ZK_PROVER_URL", "http://127.0.0.1:3001")
-var lightNodePointsAPI = utils.GetEnv("POINTS_API", "http://127.0.0.1:3001")
+// Store tracking the state of every tree, shared by all workers
+var stateStore TreeStateStore = NewMemoryTreeStateStore()
 
-// Global map to track tree states with mutex for thread safety
-var (
-	treeStates = make(map[string]*TreeState)
-	stateMutex sync.Mutex
-)
+// Clock of the sleep policies and tree state times, replaced in tests
+var clock Clock = time.Now
 
-func proveProof(data []string, proof_request string, proxy string) (*Proof, error) {
-	// Tạo options với proxy nếu có
-	var options []clients.RequestOptions
-	if proxy != "" {
-		log.Printf("Sử dụng proxy: %s cho yêu cầu proveProof", proxy)
-		options = append(options, clients.RequestOptions{
-			Proxy: proxy,
-		})
-	} else {
-		log.Printf("Không sử dụng proxy cho yêu cầu proveProof")
-	}
-
-	resp, err := clients.PostRequest[ZKProverPayload, ZKProverResponse](
-		zkProverURL+"/process",
-		ZKProverPayload{
-			Operation:    "prove",
-			Data:         data,
-			ProofRequest: &proof_request,
-			Proof:        nil,
-		},
-		options...,
-	)
+// SetTreeStateStore replaces the store used to track tree states. It must be
+// called before the workers are started.
+func SetTreeStateStore(store TreeStateStore) {
+	stateStore = store
+}
+
+func proveProof(ctx context.Context, log *slog.Logger, prover Prover, data []string, proof_request string) (*Proof, error) {
+	start := time.Now()
+	proof, err := prover.Prove(ctx, data, proof_request)
+	duration := time.Since(start)
+	proveDuration.WithLabelValues(resultLabel(err)).Observe(duration.Seconds())
 	if err != nil {
-		if proxy != "" {
-			log.Printf("Lỗi khi sử dụng proxy %s: %v", proxy, err)
-		}
-		return nil, fmt.Errorf("proof verification error: %v", err)
+		return nil, fmt.Errorf("proof generation error: %v", err)
+	}
+	if proof == nil {
+		return nil, fmt.Errorf("prover returned no proof for %q", proof_request)
 	}
-	log.Printf("verification done: %v", resp)
-	return resp.Proof, nil
+	log.Info("proof generated", "phase", "prove", "duration", duration, "leaf", proof.LeafValue)
+	return proof, nil
 }
 
-func verifyProofs(data []string, proof Proof, proxy string) (*string, *string, error) {
-	// Tạo options với proxy nếu có
-	var options []clients.RequestOptions
-	if proxy != "" {
-		log.Printf("Sử dụng proxy: %s cho yêu cầu verifyProofs", proxy)
-		options = append(options, clients.RequestOptions{
-			Proxy: proxy,
-		})
-	} else {
-		log.Printf("Không sử dụng proxy cho yêu cầu verifyProofs")
-	}
-
-	resp, err := clients.PostRequest[ZKProverPayload, ZKProverResponse](
-		zkProverURL+"/process",
-		ZKProverPayload{
-			Operation:    "verify",
-			Data:         data,
-			ProofRequest: nil,
-			Proof:        &proof,
-		},
-		options...,
-	)
+// verifyProofs asks the prover to verify the proof and checks that the
+// returned journal attests a verified proof for the expected on-chain root
+func verifyProofs(ctx context.Context, log *slog.Logger, prover Prover, data []string, proof Proof, expectedRoot string) (*string, *string, error) {
+	start := time.Now()
+	resp, err := prover.Verify(ctx, data, proof)
+	duration := time.Since(start)
+	verifyDuration.WithLabelValues(resultLabel(err)).Observe(duration.Seconds())
 	if err != nil {
-		if proxy != "" {
-			log.Printf("Lỗi khi sử dụng proxy %s: %v", proxy, err)
-		}
 		return nil, nil, fmt.Errorf("proof verification error: %v", err)
 	}
-	log.Printf("verification done: %v\n", resp)
+	log.Info("verification done", "phase", "verify", "duration", duration, "root", resp.Root, "verified", resp.Verified)
+
+	journal, err := DecodeJournal(resp.Receipt)
+	if err != nil {
+		return nil, nil, fmt.Errorf("invalid receipt journal: %v", err)
+	}
+	if err := journal.CheckVerified(expectedRoot); err != nil {
+		return nil, nil, fmt.Errorf("receipt journal rejected: %v", err)
+	}
+
 	return &resp.Receipt, &resp.Root, nil
 }
 
-func CollectSampleAndVerify(workerID int, proxy string) {
-	cosmosQueryClient := clients.CosmosQueryClient{}
-
-	// Khởi tạo client với proxy nếu có
-	var err error
-	if proxy != "" {
-		err = cosmosQueryClient.InitWithProxy(proxy)
-	} else {
-		err = cosmosQueryClient.Init()
+// CollectSampleAndVerify picks an active tree, proves and verifies a random
+// leaf and submits the result. The changed trees, reported by contract
+// events, are tried first and even when sleeping. It returns the id of the
+// tree it completed, empty when none was. cosmosQueryClient is shared by all
+// workers. Cancelling ctx aborts in-flight gRPC, prover and submission calls.
+func CollectSampleAndVerify(ctx context.Context, cfg *config.Config, cosmosQueryClient *clients.CosmosQueryClient, workerID int, signer Signer, prover Prover, proxy string, changed []string) (completedTreeId string) {
+	defer observeWorkerLoop(workerID, time.Now())
+
+	status := WorkerStatus{WorkerID: workerID, WalletAddress: signer.Address(), StartedAt: time.Now()}
+	defer func() {
+		status.FinishedAt = time.Now()
+		recordWorkerStatus(status)
+	}()
+	log := logger.With("worker", workerID, "wallet", signer.Address())
+	outcome := func(treeId string, o Outcome) {
+		recordOutcome(treeId, o)
+		status.TreeId = treeId
+		status.Outcome = o
 	}
 
+	sleepPolicy, err := NewSleepPolicy(cfg.Sleep, clock)
 	if err != nil {
-		log.Printf("Worker %d: failed to initialize cosmos query client: %v", workerID, err)
-		// Delay và thử lại trong lần gọi Worker tiếp theo
+		log.Error("invalid sleep policy", "error", err)
+		status.Error = err.Error()
 		return
 	}
-	defer cosmosQueryClient.Close()
 
-	treeIds, err := cosmosQueryClient.ListMerkleTreeIds()
+	treeFilter, err := newTreeFilter(cfg.Trees)
 	if err != nil {
-		log.Printf("failed to fetch tree ids: %v", err)
-		// Delay và thử lại trong lần gọi Worker tiếp theo
+		log.Error("invalid tree filter", "error", err)
+		status.Error = err.Error()
 		return
 	}
 
-	if len(treeIds) == 0 {
-		log.Println("No trees available")
+	// Read the tree list and every tree at the same block height, so a tree
+	// updated mid-cycle cannot be seen in two different states
+	height, err := cosmosQueryClient.LatestHeight(ctx)
+	if err != nil {
+		log.Error("failed to fetch latest block height", "phase", "height", "error", err)
+		status.Error = err.Error()
 		return
 	}
+	queryCtx := clients.AtHeight(ctx, height)
+	log = log.With("height", height)
 
-	// Try to find an available tree
+	// Trees are fetched page by page as the loop goes, so a worker that
+	// finds an active tree early does not list the rest
+	listed := 0
 	var activeTreeFound bool
-	for _, treeId := range treeIds {
+	isChanged := map[string]bool{}
+	for _, treeId := range changed {
+		isChanged[treeId] = true
+	}
+	treeOrder := newTreeOrder(cfg.Trees)
+	for treeId, err := range cycleTreeIds(queryCtx, cosmosQueryClient, changed, treeOrder) {
+		if err != nil {
+			log.Error("failed to fetch tree ids", "phase", "list", "error", err)
+			status.Error = err.Error()
+			// Delay và thử lại trong lần gọi Worker tiếp theo
+			return
+		}
+		listed++
+		treesListed.Inc()
+
+		if ctx.Err() != nil {
+			log.Info("verification cancelled", "error", ctx.Err())
+			return
+		}
+
+		log := log.With("tree_id", treeId)
+
 		// Skip trees that are sleeping
-		stateMutex.Lock()
-		state, exists := treeStates[treeId]
-		if exists && time.Now().Before(state.SleepUntil) {
-			log.Printf("Tree %s is sleeping until %s, skipping", treeId, state.SleepUntil.Format(time.RFC3339))
-			stateMutex.Unlock()
+		state, exists, err := stateStore.Get(treeId)
+		if err != nil {
+			log.Warn("failed to load tree state", "error", err)
+		}
+		if exists && !isChanged[treeId] && state.SleepingAt(clock()) {
+			log.Debug("tree is sleeping, skipping", "sleep_until", state.SleepUntil)
+			treesSkippedSleeping.Inc()
 			continue
 		}
-		stateMutex.Unlock()
 
 		// Get tree data
-		tree, err := cosmosQueryClient.GetMerkleTreeData(treeId)
+		tree, err := cosmosQueryClient.GetMerkleTreeData(queryCtx, treeId)
 		if err != nil {
-			log.Printf("failed to fetch tree data for %s: %v", treeId, err)
+			log.Error("failed to fetch tree data", "phase", "fetch", "error", err)
+			continue
+		}
+		if treeFilter != nil && !treeFilter(tree) {
+			log.Debug("tree does not match the filter, skipping", "metadata", tree.Metadata)
 			continue
 		}
 
 		// Check if root has changed
-		stateMutex.Lock()
-		if !exists {
-			// First time seeing this tree
-			treeStates[treeId] = &TreeState{
-				LastRoot:        tree.Root,
-				ConsecutiveSame: 0,
-			}
-			stateMutex.Unlock()
-		} else if state.LastRoot == tree.Root {
-			// Root hasn't changed - increment counter and potentially sleep
-			state.ConsecutiveSame++
-
-			if state.ConsecutiveSame >= 3 {
-				// After 3 consecutive same roots, put the tree to sleep for 5 minutes
-				sleepDuration := 5 * time.Minute
-				state.SleepUntil = time.Now().Add(sleepDuration)
-				log.Printf("Tree %s has had the same root %s for %d checks, putting to sleep for %v",
-					treeId, tree.Root, state.ConsecutiveSame, sleepDuration)
-				stateMutex.Unlock()
-				continue
-			}
-			stateMutex.Unlock()
-		} else {
-			// Root has changed - reset counter
-			state.LastRoot = tree.Root
-			state.ConsecutiveSame = 0
-			stateMutex.Unlock()
+		state, err = stateStore.Update(treeId, func(state *TreeState, exists bool) {
+			state.ObserveRoot(tree.Root, sleepPolicy)
+		})
+		if err != nil {
+			log.Warn("failed to save tree state", "error", err)
+		}
+		if state.SleepingAt(clock()) {
+			log.Info("root unchanged, putting tree to sleep", "root", tree.Root,
+				"consecutive_same", state.ConsecutiveSame, "sleep_until", state.SleepUntil)
+			continue
 		}
 
-		// Proceed with this tree
-		sample := utils.RandomElement[string](tree.Leaves)
+		// Refuse to spend prover time on leaves that do not hash to the
+		// on-chain root (corrupt or half-updated tree)
+		if localRoot := merkle.New(tree.Leaves).Root(); !strings.EqualFold(localRoot, tree.Root) {
+			log.Warn("tree is inconsistent, leaves do not hash to the on-chain root", "phase", "precheck",
+				"root", tree.Root, "local_root", localRoot)
+			outcome(treeId, OutcomeTreeInconsistent)
+			continue
+		}
+		if tree.Info != nil && tree.Info.LeafCount > 0 && tree.Info.LeafCount != len(tree.Leaves) {
+			log.Warn("tree is inconsistent, leaf count differs from its metadata", "phase", "precheck",
+				"root", tree.Root, "leaves", len(tree.Leaves), "metadata_leaf_count", tree.Info.LeafCount)
+			outcome(treeId, OutcomeTreeInconsistent)
+			continue
+		}
+
+		// Proceed with this tree, sampling only leaves this wallet has not
+		// already submitted for the current root
+		var candidates []string
+		for _, leaf := range ledger.UnsubmittedLeaves(signer.Address(), treeId, tree.Root, tree.Leaves) {
+			if !outbox.IsPending(signer.Address(), treeId, tree.Root, leaf) {
+				candidates = append(candidates, leaf)
+			}
+		}
+		if len(candidates) == 0 {
+			log.Info("every leaf was already submitted, skipping", "root", tree.Root)
+			continue
+		}
+		sample := utils.RandomElement[string](candidates)
 
 		// Track if verification was successful
 		verificationSuccessful := false
 
-		proof, err := proveProof(tree.Leaves, sample, proxy)
+		proof, err := proveProof(ctx, log, prover, tree.Leaves, sample)
 		if err != nil {
-			log.Printf("failed to prove sample for tree %s: %v", treeId, err)
+			log.Error("failed to prove sample", "phase", "prove", "root", tree.Root, "error", err)
+			outcome(treeId, OutcomeProveFailed)
 			// Continue to the next tree if proving fails
 			continue
 		}
 
-		receipt, rootHash, err := verifyProofs(tree.Leaves, *proof, proxy)
+		receipt, _, err := verifyProofs(ctx, log, prover, tree.Leaves, *proof, tree.Root)
 		if err != nil {
-			log.Printf("failed to verify sample for tree %s: %v", treeId, err)
+			log.Error("failed to verify sample", "phase", "verify", "root", tree.Root, "error", err)
+			outcome(treeId, OutcomeVerifyFailed)
 			// Continue to the next tree if verification fails
 			continue
 		}
 
-		if receipt != nil {
-			walletAddress, err := utils.GetWalletAddress()
-			if err != nil {
-				log.Printf("failed to get wallet address from private key: %v", err)
-				continue
+		if receipt != nil && IsDryRun(prover) {
+			log.Info("sample verified locally (dry run), not submitting", "root", tree.Root, "leaf", sample)
+			outcome(treeId, OutcomeDryRun)
+			activeTreeFound = true
+			completedTreeId = treeId
+			break
+		} else if receipt != nil {
+			request := SubmitProofRequest{
+				Proof:     proof.LeafValue,
+				ProofHash: utils.HashString(proof.LeafValue),
+				Receipt:   *receipt,
 			}
-
-			timestamp := fmt.Sprintf("%d", time.Now().UnixMilli())
-			msg := fmt.Sprintf("Submitting proof verification by %s of %s at %s", *walletAddress, proof.LeafValue, timestamp)
-			fmt.Printf("Signing Message %s\n", msg)
-			signature, err := utils.SignMessage(msg)
-			if err != nil {
-				log.Printf("failed to sign message: %v", err)
+			if err := signSubmission(log, signer, &request); err != nil {
+				log.Error("failed to sign message", "phase", "sign", "error", err)
 				continue
 			}
-
-			err = SubmitVerifiedProofWithProxy(*walletAddress, *signature, *proof, *receipt, timestamp, proxy)
+			submitStart := time.Now()
+			resp, err := submitProofRequest(ctx, cfg, request, proxy)
 			if err != nil {
-				log.Printf("Failed to submit verified proof: %v", err)
+				log.Error("failed to submit verified proof", "phase", "submit", "root", tree.Root,
+					"duration", time.Since(submitStart), "error", err)
+				outcome(treeId, OutcomeSubmitFailed)
+				if clients.IsRetryable(err) || ctx.Err() != nil {
+					// Keep the proof and receipt so the outbox can retry the
+					// submission, also when shutting down
+					queueErr := outbox.Enqueue(OutboxEntry{
+						Request: request,
+						TreeId:  treeId,
+						Root:    tree.Root,
+						Height:  tree.Height,
+						Proxy:   proxy,
+					}, err)
+					if queueErr != nil {
+						log.Error("failed to queue submission", "phase", "submit", "error", queueErr)
+					} else {
+						log.Info("queued submission for retry", "phase", "submit")
+						outcome(treeId, OutcomeSubmitQueued)
+					}
+				}
 				// Continue to the next tree if submission fails
 				continue
-			} else {
-				log.Printf("Successfully submitted verified proof for tree %s", treeId)
-				verificationSuccessful = true
-			}
-
-			// Update the tree state with the verified root
-			stateMutex.Lock()
-			if state, exists := treeStates[treeId]; exists {
-				if state.LastRoot != *rootHash {
-					state.LastRoot = *rootHash
-					state.ConsecutiveSame = 0
-				}
 			}
-			stateMutex.Unlock()
 
-			log.Printf("Tree %s - Sample Data %v verified with receipt %v\n", treeId, sample, *receipt)
+			log.Info("submitted verified proof", "phase", "submit", "root", tree.Root, "leaf", sample,
+				"duration", time.Since(submitStart), "response", resp)
+			verificationSuccessful = true
+			recordSubmission(treeId, tree.Root, tree.Height, request, resp)
+			status.TreeId = treeId
+			status.Outcome = OutcomeSubmitted
 		} else {
-			log.Printf("Tree %s - Verification failed: missing receipt or root hash", treeId)
+			log.Error("verification failed: missing receipt", "phase", "verify", "root", tree.Root)
+			outcome(treeId, OutcomeVerifyFailed)
 			continue
 		}
 
 		// Only mark as complete if verification was successful
 		if verificationSuccessful {
 			activeTreeFound = true
+			completedTreeId = treeId
 			break
 		}
 	}
 
+	if listed == 0 {
+		log.Info("no trees available", "phase", "list")
+		return
+	}
 	if !activeTreeFound {
-		log.Println("No active trees available for verification or all verification attempts failed")
+		log.Info("no active trees available for verification or all verification attempts failed")
+	}
+	return completedTreeId
+}
+
+// newTreeFilter builds the filter selecting the trees to sample, nil when
+// every tree is sampled
+func newTreeFilter(cfg config.TreesConfig) (clients.TreeFilter, error) {
+	var filters []clients.TreeFilter
+	if cfg.MetadataFilter != "" {
+		pattern, err := regexp.Compile(cfg.MetadataFilter)
+		if err != nil {
+			return nil, fmt.Errorf("invalid metadata filter: %v", err)
+		}
+		filters = append(filters, clients.MetadataMatches(pattern))
+	}
+	if len(cfg.SkipTags) > 0 {
+		filters = append(filters, clients.WithoutTags(cfg.SkipTags))
+	}
+	if len(cfg.Owners) > 0 {
+		filters = append(filters, clients.OwnedBy(cfg.Owners))
+	}
+	if len(filters) == 0 {
+		return nil, nil
+	}
+	return clients.AllOf(filters...), nil
+}
+
+// newTreeOrder builds the order the trees are worked on in, nil to keep the
+// contract order
+func newTreeOrder(cfg config.TreesConfig) clients.TreeOrder {
+	var orders []clients.TreeOrder
+	if len(cfg.PreferTags) > 0 {
+		orders = append(orders, clients.PreferTags(cfg.PreferTags))
+	}
+	if cfg.Order != "" {
+		orders = append(orders, clients.ByCreatedHeight(cfg.Order == "newest"))
+	}
+	if len(orders) == 0 {
+		return nil
+	}
+	return clients.Ordered(orders...)
+}
+
+// cycleTreeIds yields the changed trees first, then the other trees of the
+// contract, each group sorted by order when it is set
+func cycleTreeIds(ctx context.Context, cosmosQueryClient *clients.CosmosQueryClient, changed []string, order clients.TreeOrder) iter.Seq2[string, error] {
+	return func(yield func(string, error) bool) {
+		seen := map[string]bool{}
+		for _, treeId := range sortTreeIds(ctx, cosmosQueryClient, changed, order, false) {
+			seen[treeId] = true
+			if !yield(treeId, nil) {
+				return
+			}
+		}
+		for page, err := range cosmosQueryClient.MerkleTreeIdPages(ctx) {
+			if err != nil {
+				yield("", err)
+				return
+			}
+			// The page is still read by the iterator, filter a copy
+			unseen := slices.DeleteFunc(slices.Clone(page), func(treeId string) bool { return seen[treeId] })
+			for _, treeId := range sortTreeIds(ctx, cosmosQueryClient, unseen, order, true) {
+				if !yield(treeId, nil) {
+					return
+				}
+			}
+		}
+	}
+}
+
+// sortTreeIds sorts treeIds by order of their trees. Sorting needs the
+// metadata of every tree, which the contract only returns with the leaves:
+// the trees are fetched through the tree cache, which config.Validate
+// requires with an order, and only their metadata is kept here, so the worker
+// loop reads each tree back from the cache when it reaches it. Trees that
+// cannot be fetched, and sleeping trees when skipSleeping is set, are left
+// unfetched and put last in their original order.
+func sortTreeIds(ctx context.Context, cosmosQueryClient *clients.CosmosQueryClient, treeIds []string, order clients.TreeOrder, skipSleeping bool) []string {
+	if order == nil || len(treeIds) < 2 {
+		return treeIds
+	}
+
+	trees := make(map[string]*clients.MerkleTree, len(treeIds))
+	var fetched, rest []string
+	for _, treeId := range treeIds {
+		if ctx.Err() != nil {
+			return treeIds
+		}
+		if skipSleeping {
+			if state, exists, _ := stateStore.Get(treeId); exists && state.SleepingAt(clock()) {
+				rest = append(rest, treeId)
+				continue
+			}
+		}
+		tree, err := cosmosQueryClient.GetMerkleTreeData(ctx, treeId)
+		if err != nil {
+			rest = append(rest, treeId)
+			continue
+		}
+		trees[treeId] = &clients.MerkleTree{ID: treeId, Metadata: tree.Metadata, Info: tree.Info}
+		fetched = append(fetched, treeId)
+	}
+
+	slices.SortStableFunc(fetched, func(a, b string) int {
+		return order(trees[a], trees[b])
+	})
+	return append(fetched, rest...)
+}
+
+// recordSubmission records an accepted submission in the ledger and on the
+// tree state. height is the block height the tree was read at.
+func recordSubmission(treeId string, root string, height int64, request SubmitProofRequest, resp map[string]interface{}) {
+	recordOutcome(treeId, OutcomeSubmitted)
+
+	err := ledger.Append(SubmissionRecord{
+		WalletAddress: request.WalletAddress,
+		TreeId:        treeId,
+		Root:          root,
+		Height:        height,
+		Leaf:          request.Proof,
+		ProofHash:     request.ProofHash,
+		Receipt:       request.Receipt,
+		Timestamp:     time.Now(),
+		Response:      resp,
+	})
+	if err != nil {
+		logger.Error("failed to record submission", "tree_id", treeId, "error", err)
+	}
+
+	// Update the tree state with the submitted root
+	_, err = stateStore.Update(treeId, func(state *TreeState, exists bool) {
+		if state.LastRoot != root {
+			state.LastRoot = root
+			state.ConsecutiveSame = 0
+		}
+		state.LastSubmittedRoot = root
+		state.LastSubmittedAt = clock()
+	})
+	if err != nil {
+		logger.Error("failed to save tree state", "tree_id", treeId, "error", err)
 	}
 }
 
 // Helper function to get sleeping trees
 func GetSleepingTrees() []string {
-	stateMutex.Lock()
-	defer stateMutex.Unlock()
+	states, err := stateStore.All()
+	if err != nil {
+		logger.Error("failed to load tree states", "error", err)
+		return nil
+	}
 
 	var sleepingTrees []string
-	now := time.Now()
+	now := clock()
 
-	for treeId, state := range treeStates {
-		if now.Before(state.SleepUntil) {
+	for treeId, state := range states {
+		if state.SleepingAt(now) {
 			sleepingTrees = append(sleepingTrees, treeId)
 		}
 	}
@@ -296,12 +518,14 @@ func GetSleepingTrees() []string {
 	return sleepingTrees
 }
 
-func SubmitVerifiedProof(walletAddress string, signature string, proof Proof, receipt string, timestamp string) error {
+func SubmitVerifiedProof(ctx context.Context, cfg *config.Config, walletAddress string, signature string, proof Proof, receipt string, timestamp string) (map[string]interface{}, error) {
 	// Sử dụng proxy từ CosmosQueryClient
-	return SubmitVerifiedProofWithProxy(walletAddress, signature, proof, receipt, timestamp, "")
+	return SubmitVerifiedProofWithProxy(ctx, cfg, walletAddress, signature, proof, receipt, timestamp, "")
 }
 
-func SubmitVerifiedProofWithProxy(walletAddress string, signature string, proof Proof, receipt string, timestamp string, proxy string) error {
+// SubmitVerifiedProofWithProxy submits the verified proof to the points API
+// and returns the API response
+func SubmitVerifiedProofWithProxy(ctx context.Context, cfg *config.Config, walletAddress string, signature string, proof Proof, receipt string, timestamp string, proxy string) (map[string]interface{}, error) {
 	// Create the proof hash (this appears to be required by the API)
 	// Note: You may need to adjust how proofHash is calculated based on your requirements
 	proofHash := utils.HashString(proof.LeafValue) // Assuming utils.HashString exists
@@ -315,32 +539,53 @@ func SubmitVerifiedProofWithProxy(walletAddress string, signature string, proof
 		Receipt:       receipt,
 	}
 
-	// Tạo options với proxy nếu có
-	var options []clients.RequestOptions
-	if proxy != "" {
-		log.Printf("Sử dụng proxy: %s cho yêu cầu SubmitVerifiedProof", proxy)
-		options = append(options, clients.RequestOptions{
-			Proxy: proxy,
-		})
-	} else {
-		log.Printf("Không sử dụng proxy cho yêu cầu SubmitVerifiedProof")
+	return submitProofRequest(ctx, cfg, requestBody, proxy)
+}
+
+// signSubmission signs request for signer with a fresh timestamp, as the
+// points API rejects stale signatures
+func signSubmission(log *slog.Logger, signer Signer, request *SubmitProofRequest) error {
+	timestamp := fmt.Sprintf("%d", clock().UnixMilli())
+	msg := fmt.Sprintf("Submitting proof verification by %s of %s at %s", signer.Address(), request.Proof, timestamp)
+	log.Debug("signing message", "phase", "sign", "message", msg)
+	signature, err := signer.SignMessage(msg)
+	if err != nil {
+		return err
+	}
+
+	request.WalletAddress = signer.Address()
+	request.Sign = signature
+	request.Timestamp = timestamp
+	return nil
+}
+
+// submitProofRequest posts a prepared submission to the points API. Errors
+// wrap the clients.PostRequest error so callers can classify them with
+// clients.IsRetryable.
+func submitProofRequest(ctx context.Context, cfg *config.Config, requestBody SubmitProofRequest, proxy string) (map[string]interface{}, error) {
+	// Use the worker's proxy when it has one
+	options := clients.RequestOptions{
+		Proxy:   proxy,
+		Timeout: int(cfg.RequestTimeout.Duration() / time.Second),
 	}
+	logger.Debug("submitting verified proof", "phase", "submit", "wallet", requestBody.WalletAddress, "proxy", proxy != "")
 
 	// Make the API request
 	// You may need to adjust the URL based on your environment
 	resp, err := clients.PostRequest[SubmitProofRequest, map[string]interface{}](
-		lightNodePointsAPI+"/api/cli-node/submit-verified-proof",
+		ctx,
+		strings.TrimSuffix(cfg.Points.URL, "/")+"/api/cli-node/submit-verified-proof",
 		requestBody,
-		options...,
+		options,
 	)
+	submissions.WithLabelValues(submissionStatusLabel(err)).Inc()
 
 	if err != nil {
 		if proxy != "" {
-			log.Printf("Lỗi khi sử dụng proxy %s: %v", proxy, err)
+			return nil, fmt.Errorf("failed to submit verified proof through proxy: %w", err)
 		}
-		return fmt.Errorf("failed to submit verified proof: %v", err)
+		return nil, fmt.Errorf("failed to submit verified proof: %w", err)
 	}
 
-	log.Printf("Proof submission result: %v", resp)
-	return nil
+	return *resp, nil
 }
@@ -0,0 +1,47 @@
+package node
+
+import (
+	"sort"
+	"sync"
+	"time"
+)
+
+// WorkerStatus is the result of the latest CollectSampleAndVerify run of a
+// worker
+type WorkerStatus struct {
+	WorkerID      int       `json:"worker_id"`
+	WalletAddress string    `json:"wallet_address"`
+	StartedAt     time.Time `json:"started_at"`
+	FinishedAt    time.Time `json:"finished_at"`
+	TreeId        string    `json:"tree_id,omitempty"`
+	Outcome       Outcome   `json:"outcome,omitempty"`
+	Error         string    `json:"error,omitempty"`
+}
+
+var (
+	workerStatuses = make(map[int]WorkerStatus)
+	workerMutex    sync.Mutex
+)
+
+func recordWorkerStatus(status WorkerStatus) {
+	workerMutex.Lock()
+	defer workerMutex.Unlock()
+
+	workerStatuses[status.WorkerID] = status
+}
+
+// GetWorkerStatuses returns the latest result of every worker, ordered by
+// worker id
+func GetWorkerStatuses() []WorkerStatus {
+	workerMutex.Lock()
+	defer workerMutex.Unlock()
+
+	statuses := make([]WorkerStatus, 0, len(workerStatuses))
+	for _, status := range workerStatuses {
+		statuses = append(statuses, status)
+	}
+	sort.Slice(statuses, func(i, j int) bool {
+		return statuses[i].WorkerID < statuses[j].WorkerID
+	})
+	return statuses
+}
@@ -1,17 +1,13 @@
 package utils
 
 import (
-	"log"
 	"os"
-
-	"github.com/joho/godotenv"
 )
 
+// GetEnv returns the value of the environment variable key, or defaultValue
+// when it is not set. It only reads the process environment; the .env file
+// is read once at startup by the config package.
 func GetEnv(key, defaultValue string) string {
-	err := godotenv.Load()
-	if err != nil {
-		log.Println("Warning: .env file not loaded in processor")
-	}
 	if value, exists := os.LookupEnv(key); exists {
 		return value
 	}
@@ -4,7 +4,6 @@ import (
 	"bufio"
 	"fmt"
 	"io"
-	"log"
 	"net/http"
 	"net/url"
 	"os"
@@ -180,7 +179,7 @@ func CheckAllProxies() (map[string]string, error) {
 		}
 
 		// Log kết quả
-		log.Printf("Proxy %d: %s - %s", i+1, proxy, results[proxy])
+		logger.Info("checked proxy", "index", i+1, "proxy", proxy, "result", results[proxy])
 	}
 
 	return results, nil
@@ -5,12 +5,9 @@ import (
 	"crypto/ecdsa"
 	"encoding/hex"
 	"fmt"
-	"log"
-	"math/rand"
 	"os"
 	"strings"
 	"sync"
-	"time"
 
 	"github.com/ethereum/go-ethereum/common/hexutil"
 	"github.com/ethereum/go-ethereum/crypto"
@@ -23,8 +20,9 @@ var (
 	keysMutex   sync.Mutex
 )
 
-// LoadPrivateKeysFromFile loads private keys from wallet.txt file
-func LoadPrivateKeysFromFile() ([]string, error) {
+// LoadPrivateKeysFromFile loads private keys from wallet.txt file, falling
+// back to fallbackKey when the file is missing or empty
+func LoadPrivateKeysFromFile(fallbackKey string) ([]string, error) {
 	keysMutex.Lock()
 	defer keysMutex.Unlock()
 
@@ -34,14 +32,13 @@ func LoadPrivateKeysFromFile() ([]string, error) {
 
 	file, err := os.Open("wallet.txt")
 	if err != nil {
-		// If wallet.txt doesn't exist, try to use the private key from .env
-		privKey := GetEnv("PRIVATE_KEY", "")
-		if privKey != "" {
-			privateKeys = []string{privKey}
+		// If wallet.txt doesn't exist, try to use the configured private key
+		if fallbackKey != "" {
+			privateKeys = []string{fallbackKey}
 			keysLoaded = true
 			return privateKeys, nil
 		}
-		return nil, fmt.Errorf("failed to open wallet.txt and no PRIVATE_KEY in .env: %v", err)
+		return nil, fmt.Errorf("failed to open wallet.txt and no PRIVATE_KEY configured: %v", err)
 	}
 	defer file.Close()
 
@@ -59,12 +56,11 @@ func LoadPrivateKeysFromFile() ([]string, error) {
 	}
 
 	if len(keys) == 0 {
-		// If wallet.txt is empty, try to use the private key from .env
-		privKey := GetEnv("PRIVATE_KEY", "")
-		if privKey != "" {
-			keys = []string{privKey}
+		// If wallet.txt is empty, try to use the configured private key
+		if fallbackKey != "" {
+			keys = []string{fallbackKey}
 		} else {
-			return nil, fmt.Errorf("wallet.txt is empty and no PRIVATE_KEY in .env")
+			return nil, fmt.Errorf("wallet.txt is empty and no PRIVATE_KEY configured")
 		}
 	}
 
@@ -73,46 +69,9 @@ func LoadPrivateKeysFromFile() ([]string, error) {
 	return keys, nil
 }
 
-// GetRandomPrivateKey returns a random private key from the loaded keys
-func GetRandomPrivateKey() (string, error) {
-	keys, err := LoadPrivateKeysFromFile()
-	if err != nil {
-		return "", err
-	}
-
-	if len(keys) == 0 {
-		return "", fmt.Errorf("no private keys available")
-	}
-
-	rand.Seed(time.Now().UnixNano())
-	randomIndex := rand.Intn(len(keys))
-	return keys[randomIndex], nil
-}
-
-func GetCompressedPublicKey() (string, error) {
-	privKey, err := GetRandomPrivateKey()
-	if err != nil {
-		return "", err
-	}
-
-	privateKey, err := crypto.HexToECDSA(privKey)
-	if err != nil {
-		return "", fmt.Errorf("invalid private key: %v", err)
-	}
-
-	// Get the public key
-	publicKey := privateKey.Public().(*ecdsa.PublicKey)
-
-	// Serialize the public key in compressed format
-	compressedPubKey := secp256k1.CompressPubkey(publicKey.X, publicKey.Y)
-
-	// Convert to hex string
-	return hex.EncodeToString(compressedPubKey), nil
-}
-
 // GetAllCompressedPublicKeys returns all compressed public keys from the loaded private keys
 func GetAllCompressedPublicKeys() ([]string, error) {
-	keys, err := LoadPrivateKeysFromFile()
+	keys, err := LoadPrivateKeysFromFile("")
 	if err != nil {
 		return nil, err
 	}
@@ -121,7 +80,7 @@ func GetAllCompressedPublicKeys() ([]string, error) {
 	for _, privKey := range keys {
 		privateKey, err := crypto.HexToECDSA(privKey)
 		if err != nil {
-			log.Printf("Invalid private key: %v", err)
+			logger.Warn("invalid private key", "error", err)
 			continue
 		}
 
@@ -137,26 +96,9 @@ func GetAllCompressedPublicKeys() ([]string, error) {
 	return pubKeys, nil
 }
 
-func GetWalletAddress() (*string, error) {
-	privKey, err := GetRandomPrivateKey()
-	if err != nil {
-		return nil, err
-	}
-
-	privateKey, err := crypto.HexToECDSA(privKey)
-	if err != nil {
-		return nil, err
-	}
-
-	publicKey := privateKey.PublicKey
-
-	walletAddress := crypto.PubkeyToAddress(publicKey).Hex()
-	return &walletAddress, nil
-}
-
 // GetAllWalletAddresses returns all wallet addresses from the loaded private keys
 func GetAllWalletAddresses() ([]string, error) {
-	keys, err := LoadPrivateKeysFromFile()
+	keys, err := LoadPrivateKeysFromFile("")
 	if err != nil {
 		return nil, err
 	}
@@ -165,7 +107,7 @@ func GetAllWalletAddresses() ([]string, error) {
 	for _, privKey := range keys {
 		privateKey, err := crypto.HexToECDSA(privKey)
 		if err != nil {
-			log.Printf("Invalid private key: %v", err)
+			logger.Warn("invalid private key", "error", err)
 			continue
 		}
 
@@ -181,17 +123,9 @@ func GetAllWalletAddresses() ([]string, error) {
 	return addresses, nil
 }
 
-func SignMessage(message string) (*string, error) {
-	privKey, err := GetRandomPrivateKey()
-	if err != nil {
-		return nil, err
-	}
-
-	privateKey, err := crypto.HexToECDSA(privKey)
-	if err != nil {
-		return nil, err
-	}
-
+// SignMessageWithKey signs a message with the given private key using the
+// Ethereum personal_sign prefix, so the signature recovers to the key's address
+func SignMessageWithKey(message string, privateKey *ecdsa.PrivateKey) (*string, error) {
 	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)
 
 	data := []byte(prefix)
@@ -209,7 +143,7 @@ func SignMessage(message string) (*string, error) {
 
 // SignMessageWithSpecificKey signs a message with a specific private key
 func SignMessageWithSpecificKey(message string, privKeyIndex int) (*string, error) {
-	keys, err := LoadPrivateKeysFromFile()
+	keys, err := LoadPrivateKeysFromFile("")
 	if err != nil {
 		return nil, err
 	}
@@ -224,19 +158,7 @@ func SignMessageWithSpecificKey(message string, privKeyIndex int) (*string, erro
 		return nil, err
 	}
 
-	prefix := fmt.Sprintf("\x19Ethereum Signed Message:\n%d%s", len(message), message)
-
-	data := []byte(prefix)
-	hash := crypto.Keccak256Hash(data)
-
-	signature, err := crypto.Sign(hash.Bytes(), privateKey)
-	if err != nil {
-		return nil, err
-	}
-	signature[64] += 27
-
-	hexSign := hexutil.Encode(signature)
-	return &hexSign, nil
+	return SignMessageWithKey(message, privateKey)
 }
 
 func VerifyMessage(sign string, message string, expectedAddress string) error {
@@ -244,11 +166,11 @@ func VerifyMessage(sign string, message string, expectedAddress string) error {
 	messageHash := crypto.Keccak256Hash([]byte(prefix))
 	signature, err := hexutil.Decode(sign)
 	if err != nil {
-		log.Printf("invalid signature")
+		logger.Debug("invalid signature", "error", err)
 		return err
 	}
 	if len(signature) != 65 {
-		log.Println("invalid signature length")
+		logger.Debug("invalid signature length", "length", len(signature))
 		return fmt.Errorf("invalid signature length")
 	}
 
@@ -256,12 +178,15 @@ func VerifyMessage(sign string, message string, expectedAddress string) error {
 
 	pubKey, err := crypto.SigToPub(messageHash.Bytes(), signature)
 	if err != nil {
-		log.Println("Failed to recover public key:", err)
-		return fmt.Errorf("Failed to recover public key:", err)
+		logger.Debug("failed to recover public key", "error", err)
+		return fmt.Errorf("failed to recover public key: %v", err)
 	}
 
 	recoveredAddress := crypto.PubkeyToAddress(*pubKey).Hex()
 
-	log.Printf("recovered address: %s, expected address: %s", recoveredAddress, expectedAddress)
+	logger.Debug("recovered signature address", "recovered", recoveredAddress, "expected", expectedAddress)
+	if !strings.EqualFold(recoveredAddress, expectedAddress) {
+		return fmt.Errorf("signature recovers to %s, expected %s", recoveredAddress, expectedAddress)
+	}
 	return nil
 }